@@ -0,0 +1,193 @@
+package responselogger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrQueueFull is returned by AsyncWriter.Write when the queue is full and the line has been dropped.
+var ErrQueueFull = errors.New("responselogger: async writer queue is full")
+
+// ErrClosed is returned when writing to or flushing an AsyncWriter which has been closed.
+var ErrClosed = errors.New("responselogger: async writer is closed")
+
+// Default settings used by NewAsyncWriter for zero values in AsyncWriterConfig.
+const (
+	DefaultQueueSize     = 4096
+	DefaultBatchSize     = 64 * 1024
+	DefaultFlushInterval = time.Second
+)
+
+// AsyncWriterConfig configures an AsyncWriter.
+type AsyncWriterConfig struct {
+	// QueueSize is the maximum number of lines waiting to be written. When the queue is full, lines are dropped.
+	QueueSize int
+	// BatchSize is the number of bytes to collect before writing them to the underlying writer.
+	BatchSize int
+	// FlushInterval is the maximum time a line waits in a batch before it's written.
+	FlushInterval time.Duration
+	// OnError, if not nil, is called when writing a batch to the underlying writer fails.
+	OnError func(err error)
+}
+
+// AsyncWriter is an io.Writer which queues lines and writes them to an underlying io.Writer in batches on a
+// background goroutine, to keep logging off the request path. Use it with NewJSONEntryWriter, and call Close
+// after http.Server.Shutdown to write any remaining lines.
+type AsyncWriter struct {
+	w             io.Writer
+	queue         chan []byte
+	flushRequests chan chan struct{}
+	done          chan struct{}
+	batchSize     int
+	flushInterval time.Duration
+	onError       func(err error)
+
+	m      sync.RWMutex
+	closed bool
+
+	dropped int64
+	errors  int64
+}
+
+// NewAsyncWriter creates an AsyncWriter which writes to w and starts its background goroutine.
+func NewAsyncWriter(w io.Writer, config AsyncWriterConfig) *AsyncWriter {
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultQueueSize
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultFlushInterval
+	}
+	aw := &AsyncWriter{
+		w:             w,
+		queue:         make(chan []byte, config.QueueSize),
+		flushRequests: make(chan chan struct{}),
+		done:          make(chan struct{}),
+		batchSize:     config.BatchSize,
+		flushInterval: config.FlushInterval,
+		onError:       config.OnError,
+	}
+	go aw.run()
+	return aw
+}
+
+// Write queues a copy of p to be written. If the queue is full, the line is dropped and ErrQueueFull is returned.
+func (aw *AsyncWriter) Write(p []byte) (int, error) {
+	aw.m.RLock()
+	defer aw.m.RUnlock()
+	if aw.closed {
+		return 0, ErrClosed
+	}
+	line := make([]byte, len(p))
+	copy(line, p)
+	select {
+	case aw.queue <- line:
+		return len(p), nil
+	default:
+		atomic.AddInt64(&aw.dropped, 1)
+		return 0, ErrQueueFull
+	}
+}
+
+// Flush writes all queued lines to the underlying writer, waiting until they're written or ctx is done.
+func (aw *AsyncWriter) Flush(ctx context.Context) error {
+	ack := make(chan struct{})
+	select {
+	case aw.flushRequests <- ack:
+	case <-aw.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ack:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting lines, and waits until all queued lines have been written.
+func (aw *AsyncWriter) Close() error {
+	aw.m.Lock()
+	if !aw.closed {
+		aw.closed = true
+		close(aw.queue)
+	}
+	aw.m.Unlock()
+	<-aw.done
+	return nil
+}
+
+// Dropped returns the number of lines dropped because the queue was full.
+func (aw *AsyncWriter) Dropped() int64 {
+	return atomic.LoadInt64(&aw.dropped)
+}
+
+// Errors returns the number of batches which could not be written to the underlying writer.
+func (aw *AsyncWriter) Errors() int64 {
+	return atomic.LoadInt64(&aw.errors)
+}
+
+func (aw *AsyncWriter) run() {
+	defer close(aw.done)
+	ticker := time.NewTicker(aw.flushInterval)
+	defer ticker.Stop()
+
+	var batch bytes.Buffer
+	for {
+		select {
+		case line, ok := <-aw.queue:
+			if !ok {
+				aw.writeBatch(&batch)
+				return
+			}
+			batch.Write(line)
+			if batch.Len() >= aw.batchSize {
+				aw.writeBatch(&batch)
+			}
+		case <-ticker.C:
+			aw.writeBatch(&batch)
+		case ack := <-aw.flushRequests:
+			aw.drain(&batch)
+			aw.writeBatch(&batch)
+			close(ack)
+		}
+	}
+}
+
+// drain moves the lines currently in the queue into the batch.
+func (aw *AsyncWriter) drain(batch *bytes.Buffer) {
+	for {
+		select {
+		case line, ok := <-aw.queue:
+			if !ok {
+				return
+			}
+			batch.Write(line)
+		default:
+			return
+		}
+	}
+}
+
+func (aw *AsyncWriter) writeBatch(batch *bytes.Buffer) {
+	if batch.Len() == 0 {
+		return
+	}
+	_, err := aw.w.Write(batch.Bytes())
+	batch.Reset()
+	if err != nil {
+		atomic.AddInt64(&aw.errors, 1)
+		if aw.onError != nil {
+			aw.onError(err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package responselogger
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type syncBuffer struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.m.Lock()
+	defer sb.m.Unlock()
+	return sb.buf.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.m.Lock()
+	defer sb.m.Unlock()
+	return sb.buf.String()
+}
+
+// blockingWriter signals on started when a write begins, then waits for release.
+type blockingWriter struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (bw blockingWriter) Write(p []byte) (int, error) {
+	select {
+	case bw.started <- struct{}{}:
+	default:
+	}
+	<-bw.release
+	return len(p), nil
+}
+
+func TestAsyncWriterFlush(t *testing.T) {
+	sb := &syncBuffer{}
+	aw := NewAsyncWriter(sb, AsyncWriterConfig{FlushInterval: time.Hour})
+	defer aw.Close()
+
+	aw.Write([]byte("line 1\n"))
+	aw.Write([]byte("line 2\n"))
+	if err := aw.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error flushing: %v", err)
+	}
+
+	if sb.String() != "line 1\nline 2\n" {
+		t.Errorf("expected both lines to be written, got '%v'", sb.String())
+	}
+}
+
+func TestAsyncWriterBatchSize(t *testing.T) {
+	sb := &syncBuffer{}
+	aw := NewAsyncWriter(sb, AsyncWriterConfig{BatchSize: 1, FlushInterval: time.Hour})
+	defer aw.Close()
+
+	aw.Write([]byte("line 1\n"))
+	deadline := time.Now().Add(time.Second)
+	for sb.String() == "" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if sb.String() != "line 1\n" {
+		t.Errorf("expected the line to be written once the batch size was reached, got '%v'", sb.String())
+	}
+}
+
+func TestAsyncWriterFlushInterval(t *testing.T) {
+	sb := &syncBuffer{}
+	aw := NewAsyncWriter(sb, AsyncWriterConfig{FlushInterval: time.Millisecond * 10})
+	defer aw.Close()
+
+	aw.Write([]byte("line 1\n"))
+	deadline := time.Now().Add(time.Second)
+	for sb.String() == "" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if sb.String() != "line 1\n" {
+		t.Errorf("expected the line to be written after the flush interval, got '%v'", sb.String())
+	}
+}
+
+func TestAsyncWriterClose(t *testing.T) {
+	sb := &syncBuffer{}
+	aw := NewAsyncWriter(sb, AsyncWriterConfig{FlushInterval: time.Hour})
+
+	aw.Write([]byte("line 1\n"))
+	if err := aw.Close(); err != nil {
+		t.Fatalf("unexpected error closing: %v", err)
+	}
+
+	if sb.String() != "line 1\n" {
+		t.Errorf("expected queued lines to be written on close, got '%v'", sb.String())
+	}
+	if _, err := aw.Write([]byte("line 2\n")); err != ErrClosed {
+		t.Errorf("expected ErrClosed writing after close, got %v", err)
+	}
+	if err := aw.Flush(context.Background()); err != ErrClosed {
+		t.Errorf("expected ErrClosed flushing after close, got %v", err)
+	}
+	if err := aw.Close(); err != nil {
+		t.Errorf("expected closing twice to succeed, got %v", err)
+	}
+}
+
+func TestAsyncWriterDropsWhenFull(t *testing.T) {
+	bw := blockingWriter{started: make(chan struct{}, 1), release: make(chan struct{})}
+	aw := NewAsyncWriter(bw, AsyncWriterConfig{QueueSize: 1, BatchSize: 1, FlushInterval: time.Hour})
+
+	aw.Write([]byte("line 1\n"))
+	<-bw.started
+
+	if _, err := aw.Write([]byte("line 2\n")); err != nil {
+		t.Errorf("expected line 2 to be queued, got %v", err)
+	}
+	if _, err := aw.Write([]byte("line 3\n")); err != ErrQueueFull {
+		t.Errorf("expected line 3 to be dropped with ErrQueueFull, got %v", err)
+	}
+	if aw.Dropped() != 1 {
+		t.Errorf("expected 1 dropped line, got %d", aw.Dropped())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if err := aw.Flush(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected flush to time out while the writer is blocked, got %v", err)
+	}
+
+	close(bw.release)
+	aw.Close()
+}
+
+func TestAsyncWriterErrors(t *testing.T) {
+	var errs []error
+	aw := NewAsyncWriter(errorWriter{}, AsyncWriterConfig{
+		FlushInterval: time.Hour,
+		OnError:       func(err error) { errs = append(errs, err) },
+	})
+
+	aw.Write([]byte("line 1\n"))
+	aw.Close()
+
+	if aw.Errors() != 1 {
+		t.Errorf("expected 1 error, got %d", aw.Errors())
+	}
+	if len(errs) != 1 || errs[0].Error() != "disk full" {
+		t.Errorf("expected the write error to be passed to the callback, got %v", errs)
+	}
+}
+
+func BenchmarkAsyncWriter(b *testing.B) {
+	aw := NewAsyncWriter(&bytes.Buffer{}, AsyncWriterConfig{})
+	defer aw.Close()
+	line := []byte(`{"time":"2000-01-02T03:04:05Z","src":"rl","status":200,"http_2xx":1,"len":454,"ms":300,"method":"GET","path":"/test"}` + "\n")
+	for i := 0; i < b.N; i++ {
+		aw.Write(line)
+	}
+}
@@ -0,0 +1,124 @@
+package responselogger
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParsePrefixes parses CIDR ranges, e.g. "10.0.0.0/8", for use as Handler.TrustedProxies. Single addresses are
+// also accepted.
+func ParsePrefixes(cidrs ...string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, len(cidrs))
+	for i, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, err
+			}
+			prefixes[i] = netip.PrefixFrom(addr, addr.BitLen())
+			continue
+		}
+		p, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		prefixes[i] = p.Masked()
+	}
+	return prefixes, nil
+}
+
+// DefaultClientIPHeader is the header set by most load balancers with the address of the client.
+const DefaultClientIPHeader = "X-Forwarded-For"
+
+// ClientIP returns the IP address of the client which made the request. If the request came from a trusted proxy,
+// the given header is used, e.g. "X-Forwarded-For", "X-Real-IP" or "Forwarded" (RFC 7239). Only that header is
+// read, as a proxy which sets one header passes the others on from the client unchanged. Addresses in the header
+// are read from right to left, skipping trusted proxies, so that a client can't spoof its address by sending the
+// header itself.
+func ClientIP(r *http.Request, header string, trustedProxies []netip.Prefix) string {
+	remote, ok := parseAddr(r.RemoteAddr)
+	if !ok {
+		return ""
+	}
+	if header == "" || !isTrusted(remote, trustedProxies) {
+		return remote.String()
+	}
+	values := r.Header.Values(header)
+	if len(values) == 0 {
+		return remote.String()
+	}
+	if strings.EqualFold(header, "Forwarded") {
+		return rightmostUntrusted(remote, forwardedFor(values), trustedProxies).String()
+	}
+	return rightmostUntrusted(remote, splitList(values), trustedProxies).String()
+}
+
+// rightmostUntrusted walks the addresses from right to left, returning the first which isn't trusted. If an
+// address can't be parsed, or all of them are trusted, the last valid address is returned.
+func rightmostUntrusted(remote netip.Addr, addrs []string, trustedProxies []netip.Prefix) netip.Addr {
+	client := remote
+	for i := len(addrs) - 1; i >= 0; i-- {
+		addr, ok := parseAddr(addrs[i])
+		if !ok {
+			break
+		}
+		client = addr
+		if !isTrusted(addr, trustedProxies) {
+			break
+		}
+	}
+	return client
+}
+
+func isTrusted(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, p := range trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAddr parses an IP address, with an optional port, and optionally in square brackets.
+func parseAddr(s string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
+
+// splitList splits comma separated header values.
+func splitList(values []string) []string {
+	var op []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			op = append(op, strings.TrimSpace(item))
+		}
+	}
+	return op
+}
+
+// forwardedFor returns the "for" parameters of Forwarded header values, e.g.
+// `for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"`.
+func forwardedFor(values []string) []string {
+	var op []string
+	for _, element := range splitList(values) {
+		var f string
+		for _, pair := range strings.Split(element, ";") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+				f = strings.Trim(kv[1], `"`)
+			}
+		}
+		// Elements without a valid "for" are kept so that the walk stops at them.
+		op = append(op, f)
+	}
+	return op
+}
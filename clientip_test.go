@@ -0,0 +1,184 @@
+package responselogger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParsePrefixes("10.0.0.0/8", "192.168.1.1", "fd00::/8")
+	if err != nil {
+		t.Fatalf("failed to parse prefixes: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		headers    map[string][]string
+		expected   string
+	}{
+		{
+			name:       "direct",
+			remoteAddr: "203.0.113.5:1234",
+			header:     "X-Forwarded-For",
+			expected:   "203.0.113.5",
+		},
+		{
+			name:       "untrusted proxy headers are ignored",
+			remoteAddr: "203.0.113.5:1234",
+			header:     "X-Forwarded-For",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1"}},
+			expected:   "203.0.113.5",
+		},
+		{
+			name:       "X-Forwarded-For from trusted proxy",
+			remoteAddr: "10.0.0.1:1234",
+			header:     "X-Forwarded-For",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1"}},
+			expected:   "198.51.100.1",
+		},
+		{
+			name:       "spoofed X-Forwarded-For",
+			remoteAddr: "10.0.0.1:1234",
+			header:     "X-Forwarded-For",
+			headers:    map[string][]string{"X-Forwarded-For": {"1.2.3.4, 198.51.100.1, 10.0.0.2"}},
+			expected:   "198.51.100.1",
+		},
+		{
+			name:       "multiple X-Forwarded-For headers",
+			remoteAddr: "10.0.0.1:1234",
+			header:     "X-Forwarded-For",
+			headers:    map[string][]string{"X-Forwarded-For": {"1.2.3.4", "198.51.100.1"}},
+			expected:   "198.51.100.1",
+		},
+		{
+			name:       "all trusted",
+			remoteAddr: "10.0.0.1:1234",
+			header:     "X-Forwarded-For",
+			headers:    map[string][]string{"X-Forwarded-For": {"10.0.0.3, 192.168.1.1"}},
+			expected:   "10.0.0.3",
+		},
+		{
+			name:       "invalid X-Forwarded-For entry",
+			remoteAddr: "10.0.0.1:1234",
+			header:     "X-Forwarded-For",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1, garbage, 10.0.0.2"}},
+			expected:   "10.0.0.2",
+		},
+		{
+			name:       "X-Real-IP",
+			remoteAddr: "192.168.1.1:1234",
+			header:     "X-Real-IP",
+			headers:    map[string][]string{"X-Real-Ip": {"198.51.100.1"}},
+			expected:   "198.51.100.1",
+		},
+		{
+			name:       "Forwarded",
+			remoteAddr: "10.0.0.1:1234",
+			header:     "Forwarded",
+			headers: map[string][]string{
+				"Forwarded":       {`for=1.2.3.4, for=198.51.100.1;proto=https;by=10.0.0.1`},
+				"X-Forwarded-For": {"5.6.7.8"},
+			},
+			expected: "198.51.100.1",
+		},
+		{
+			name:       "Forwarded ignored when X-Forwarded-For is configured",
+			remoteAddr: "10.0.0.1:1234",
+			header:     "X-Forwarded-For",
+			headers: map[string][]string{
+				"Forwarded":       {`for=1.2.3.4`},
+				"X-Forwarded-For": {"198.51.100.1"},
+			},
+			expected: "198.51.100.1",
+		},
+		{
+			name:       "X-Real-IP ignored when X-Forwarded-For is configured",
+			remoteAddr: "10.0.0.1:1234",
+			header:     "X-Forwarded-For",
+			headers:    map[string][]string{"X-Real-Ip": {"1.2.3.4"}},
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "no header configured",
+			remoteAddr: "10.0.0.1:1234",
+			header:     "",
+			headers:    map[string][]string{"X-Forwarded-For": {"198.51.100.1"}},
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "Forwarded IPv6",
+			remoteAddr: "[fd00::1]:1234",
+			header:     "Forwarded",
+			headers:    map[string][]string{"Forwarded": {`For="[2001:db8:cafe::17]:4711"`}},
+			expected:   "2001:db8:cafe::17",
+		},
+		{
+			name:       "Forwarded obfuscated",
+			remoteAddr: "10.0.0.1:1234",
+			header:     "Forwarded",
+			headers:    map[string][]string{"Forwarded": {`for=_hidden, for=10.0.0.2`}},
+			expected:   "10.0.0.2",
+		},
+		{
+			name:       "invalid remote address",
+			remoteAddr: "pipe",
+			header:     "X-Forwarded-For",
+			expected:   "",
+		},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		for k, v := range test.headers {
+			r.Header[k] = v
+		}
+		actual := ClientIP(r, test.header, trusted)
+		if actual != test.expected {
+			t.Errorf("%s: expected '%v', got '%v'", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestParsePrefixesError(t *testing.T) {
+	if _, err := ParsePrefixes("10.0.0.0/33"); err == nil {
+		t.Errorf("expected an error for an invalid prefix")
+	}
+	if _, err := ParsePrefixes("not an ip"); err == nil {
+		t.Errorf("expected an error for an invalid address")
+	}
+}
+
+func TestHandlerRemoteIP(t *testing.T) {
+	var entry Entry
+	h := Handler{
+		Next:        http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		EntryLogger: EntryLoggerFunc(func(e Entry) { entry = e }),
+		Skip:        SkipHealthEndpoint,
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "203.0.113.5:1234"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if entry.RemoteIP != "203.0.113.5" {
+		t.Errorf("expected remote IP '203.0.113.5', got '%v'", entry.RemoteIP)
+	}
+}
+
+func TestJSONEntryMessageRemoteIP(t *testing.T) {
+	now := func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+	e := Entry{
+		Request:  httptest.NewRequest(http.MethodGet, "/", nil),
+		Status:   http.StatusOK,
+		RemoteIP: "203.0.113.5",
+	}
+	expected := `{"time":"2000-01-02T03:04:05Z","src":"rl","status":200,"http_2xx":1,"len":0,"ms":0,"method":"GET","path":"/","remote_ip":"203.0.113.5","req_len":0,"req_read_ms":0}` + "\n"
+	actual := JSONEntryMessage(now, e, nil)
+	if expected != actual {
+		t.Errorf("expected '%v', got '%v'", expected, actual)
+	}
+}
@@ -0,0 +1,112 @@
+package responselogger
+
+import (
+	"net/http"
+	"os"
+	"time"
+)
+
+// Entry contains the facts captured by the Handler about an HTTP request and its response.
+type Entry struct {
+	// Request is the HTTP request that was handled.
+	Request *http.Request
+	// Status is the HTTP status code written to the client.
+	Status int
+	// Length is the number of bytes written to the response body.
+	Length int64
+	// Duration is the total time taken by the next handler.
+	Duration time.Duration
+	// TTFB is the time taken until the response header was written, i.e. the time to first byte. If the handler
+	// doesn't write anything itself, the header is written when it returns, so TTFB is equal to Duration.
+	TTFB time.Duration
+	// RequestLength is the number of bytes of the request body read by the handler.
+	RequestLength int64
+	// RequestReadDuration is the time the handler spent reading the request body.
+	RequestReadDuration time.Duration
+	// ContextErr is the error of the request's context when the handler returned, e.g. context.Canceled if the
+	// client went away before the response was complete.
+	ContextErr error
+	// WriteErr is the first error returned when writing the response body.
+	WriteErr error
+	// CopyErr is the first error returned when copying the response body using io.ReaderFrom, e.g. by io.Copy.
+	// It may have been caused by the source, e.g. a failed file read, or by the client, so it doesn't set
+	// ClientClosed.
+	CopyErr error
+	// ClientClosed is true if the client disconnected before the handler returned, i.e. the request's context
+	// was cancelled or writing the response failed.
+	ClientClosed bool
+	// Hijacked is true if the handler took over the connection, e.g. for a WebSocket upgrade.
+	Hijacked bool
+	// ConnClosed is true for the additional entry logged when a hijacked connection is closed.
+	// Duration then covers the whole lifetime of the connection, and is logged as "conn_ms" rather than "ms".
+	ConnClosed bool
+	// ConnRead is the number of bytes read from a hijacked connection, set when ConnClosed is true.
+	ConnRead int64
+	// ConnWritten is the number of bytes written to a hijacked connection, set when ConnClosed is true.
+	ConnWritten int64
+	// Running is true for the entry logged by the watchdog while the handler is still running, see
+	// Handler.WatchdogThreshold. The status and length aren't known, so are zero. Duration is the time elapsed so
+	// far, and is logged as "elapsed_ms" rather than "ms".
+	Running bool
+	// Panic is the value recovered from a panic in the handler, see Handler.RecoverPanics.
+	Panic interface{}
+	// Stack is the trimmed stack trace of the panic, or of the running handler if Handler.WatchdogStack is set,
+	// one frame per item.
+	Stack []string
+	// RequestID is the ID of the request, see Handler.RequestIDHeader.
+	RequestID string
+	// Query is the query string with values redacted according to Handler.Query.
+	Query string
+	// QueryHash is the SHA-256 hash of the raw query string, if Handler.Query.HashRaw is set.
+	QueryHash string
+	// RemoteIP is the IP address of the client, see Handler.TrustedProxies.
+	RemoteIP string
+	// InFlight is the number of requests being handled when the request started, including it, see
+	// Handler.InFlight.
+	InFlight int
+	// Trace is the W3C Trace Context of the request, see Handler.TraceContext.
+	Trace TraceContext
+	// ResponseHeader contains the response headers selected by Handler.ResponseHeaders, as they were when the
+	// header was written, with their masks applied.
+	ResponseHeader http.Header
+	// SampleRate is the number of requests the entry represents, set by a Sampler. Zero if the entry wasn't sampled.
+	SampleRate int
+	// Fields are the additional fields added by handlers using AddField and AddValue.
+	Fields []Field
+}
+
+// EntryLogger defines how log entries are written, e.g. to the console, or in JSON format (see JSONEntryLogger).
+type EntryLogger interface {
+	LogEntry(e Entry)
+}
+
+// EntryLoggerFunc allows an ordinary function to be used as an EntryLogger.
+type EntryLoggerFunc func(e Entry)
+
+// LogEntry calls f(e).
+func (f EntryLoggerFunc) LogEntry(e Entry) {
+	f(e)
+}
+
+// LogEntry allows a Logger to be used as an EntryLogger. Only the request, status, length and duration are passed on.
+func (l Logger) LogEntry(e Entry) {
+	l(e.Request, e.Status, e.Length, e.Duration)
+}
+
+// JSONEntryLogger logs the Entry in JSON format to os.Stderr.
+var JSONEntryLogger EntryLoggerFunc = func(e Entry) {
+	os.Stderr.WriteString(JSONEntryMessage(time.Now, e, nil))
+}
+
+// NewJSONEntryLoggerWithHeaders returns an EntryLogger that logs the given headers of an HTTP request.
+func NewJSONEntryLoggerWithHeaders(h ...string) EntryLogger {
+	return NewJSONEntryWriter(os.Stderr, nil, h...)
+}
+
+func headerFields(r *http.Request, h []string) map[string]string {
+	m := make(map[string]string, len(h))
+	for _, name := range h {
+		m[name] = r.Header.Get(name)
+	}
+	return m
+}
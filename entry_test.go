@@ -0,0 +1,229 @@
+package responselogger
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerEntryLogger(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/test", nil)
+
+	var actual Entry
+	var logged int
+	h := Handler{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("created"))
+		}),
+		EntryLogger: EntryLoggerFunc(func(e Entry) {
+			actual = e
+			logged++
+		}),
+		Skip: SkipHealthEndpoint,
+	}
+	h.ServeHTTP(w, r)
+
+	if logged != 1 {
+		t.Fatalf("expected 1 entry to be logged, got %d", logged)
+	}
+	if actual.Request.URL != r.URL {
+		t.Errorf("expected the request to be logged")
+	}
+	if actual.Status != http.StatusCreated {
+		t.Errorf("expected status %d, got %d", http.StatusCreated, actual.Status)
+	}
+	if actual.Length != int64(len("created")) {
+		t.Errorf("expected length %d, got %d", len("created"), actual.Length)
+	}
+}
+
+func TestHandlerLoggerTakesPrecedence(t *testing.T) {
+	var loggerCalled, entryLoggerCalled bool
+	h := Handler{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		Logger: func(r *http.Request, status int, len int64, d time.Duration) {
+			loggerCalled = true
+		},
+		EntryLogger: EntryLoggerFunc(func(e Entry) {
+			entryLoggerCalled = true
+		}),
+		Skip: SkipHealthEndpoint,
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !loggerCalled {
+		t.Errorf("expected Logger to be called")
+	}
+	if entryLoggerCalled {
+		t.Errorf("expected EntryLogger not to be called when Logger is set")
+	}
+}
+
+func TestLoggerAsEntryLogger(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/test", nil)
+	expected := Entry{
+		Request:  r,
+		Status:   http.StatusNotFound,
+		Length:   12,
+		Duration: time.Millisecond * 5,
+	}
+
+	var actual Entry
+	var l EntryLogger = Logger(func(r *http.Request, status int, len int64, d time.Duration) {
+		actual = Entry{Request: r, Status: status, Length: len, Duration: d}
+	})
+	l.LogEntry(expected)
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+}
+
+func TestJSONEntryMessageMatchesJSONLogMessage(t *testing.T) {
+	now := func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+	r := httptest.NewRequest(http.MethodGet, "/test", nil)
+	e := Entry{
+		Request:  r,
+		Status:   http.StatusOK,
+		Length:   454,
+		Duration: time.Millisecond * 300,
+	}
+
+	// JSONLogMessage doesn't receive the request length, so only JSONEntryMessage writes it.
+	legacy := JSONLogMessage(now, r.Method, r.URL, e.Status, e.Length, e.Duration, nil)
+	expected := strings.TrimSuffix(legacy, "}\n") + `,"req_len":0,"req_read_ms":0}` + "\n"
+	actual := JSONEntryMessage(now, e, nil)
+	if expected != actual {
+		t.Errorf("expected '%v', got '%v'", expected, actual)
+	}
+}
+
+func TestJSONEntryMessageHijacked(t *testing.T) {
+	now := func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+	e := Entry{
+		Request:     httptest.NewRequest(http.MethodGet, "/ws", nil),
+		Status:      http.StatusSwitchingProtocols,
+		Duration:    time.Second,
+		Hijacked:    true,
+		ConnClosed:  true,
+		ConnRead:    10,
+		ConnWritten: 20,
+	}
+	expected := `{"time":"2000-01-02T03:04:05Z","src":"rl","status":101,"len":0,"method":"GET","path":"/ws","req_len":0,"req_read_ms":0,"hijacked":true,"conn_closed":true,"conn_ms":1000,"conn_read":10,"conn_written":20}` + "\n"
+	actual := JSONEntryMessage(now, e, nil)
+	if expected != actual {
+		t.Errorf("expected '%v', got '%v'", expected, actual)
+	}
+}
+
+func TestJSONEntryMessagePanic(t *testing.T) {
+	now := func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+	e := Entry{
+		Request: httptest.NewRequest(http.MethodGet, "/", nil),
+		Status:  http.StatusInternalServerError,
+		Panic:   "oops",
+		Stack:   []string{"main.a /src/main.go:10", "main.b /src/main.go:20"},
+	}
+	expected := `{"time":"2000-01-02T03:04:05Z","src":"rl","status":500,"http_5xx":1,"len":0,"ms":0,"method":"GET","path":"/","req_len":0,"req_read_ms":0,"panic":"oops","stack":["main.a /src/main.go:10","main.b /src/main.go:20"]}` + "\n"
+	actual := JSONEntryMessage(now, e, nil)
+	if expected != actual {
+		t.Errorf("expected '%v', got '%v'", expected, actual)
+	}
+}
+
+func TestJSONEntryMessageTTFB(t *testing.T) {
+	now := func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+	e := Entry{
+		Request:  httptest.NewRequest(http.MethodGet, "/", nil),
+		Status:   http.StatusOK,
+		Length:   10,
+		Duration: time.Millisecond * 300,
+		TTFB:     time.Millisecond * 20,
+	}
+	expected := `{"time":"2000-01-02T03:04:05Z","src":"rl","status":200,"http_2xx":1,"len":10,"ms":300,"method":"GET","path":"/","ttfb_ms":20,"req_len":0,"req_read_ms":0}` + "\n"
+	actual := JSONEntryMessage(now, e, nil)
+	if expected != actual {
+		t.Errorf("expected '%v', got '%v'", expected, actual)
+	}
+}
+
+func TestJSONEntryMessageRequestLength(t *testing.T) {
+	now := func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+	e := Entry{
+		Request:             httptest.NewRequest(http.MethodPost, "/upload", nil),
+		Status:              http.StatusOK,
+		Length:              2,
+		Duration:            time.Millisecond * 300,
+		RequestLength:       1024,
+		RequestReadDuration: time.Millisecond * 250,
+	}
+	expected := `{"time":"2000-01-02T03:04:05Z","src":"rl","status":200,"http_2xx":1,"len":2,"ms":300,"method":"POST","path":"/upload","req_len":1024,"req_read_ms":250}` + "\n"
+	actual := JSONEntryMessage(now, e, nil)
+	if expected != actual {
+		t.Errorf("expected '%v', got '%v'", expected, actual)
+	}
+}
+
+func TestJSONEntryMessageClientClosed(t *testing.T) {
+	now := func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+	e := Entry{
+		Request:      httptest.NewRequest(http.MethodGet, "/", nil),
+		Status:       http.StatusOK,
+		ContextErr:   context.Canceled,
+		WriteErr:     errors.New("broken pipe"),
+		ClientClosed: true,
+	}
+	expected := `{"time":"2000-01-02T03:04:05Z","src":"rl","status":200,"http_2xx":1,"len":0,"ms":0,"method":"GET","path":"/","client_closed":true,"ctx_err":"context canceled","write_err":"broken pipe","req_len":0,"req_read_ms":0}` + "\n"
+	actual := JSONEntryMessage(now, e, nil)
+	if expected != actual {
+		t.Errorf("expected '%v', got '%v'", expected, actual)
+	}
+}
+
+func TestJSONEntryMessageFieldOrder(t *testing.T) {
+	now := func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+	e := Entry{
+		Request:       httptest.NewRequest(http.MethodPost, "/upload", nil),
+		Status:        http.StatusOK,
+		Length:        2,
+		Duration:      time.Millisecond * 300,
+		TTFB:          time.Millisecond * 20,
+		RequestLength: 1024,
+		Fields: []Field{
+			{Key: "z", Value: Int(1)},
+			{Key: "a", Value: Int(2)},
+		},
+	}
+	headers := map[string]string{
+		"X-B": "b",
+		"X-A": "a",
+	}
+	expected := `{"time":"2000-01-02T03:04:05Z","src":"rl","status":200,"http_2xx":1,"len":2,"ms":300,"method":"POST","path":"/upload","ttfb_ms":20,"req_len":1024,"req_read_ms":0,"X-A":"a","X-B":"b","z":1,"a":2}` + "\n"
+	for i := 0; i < 100; i++ {
+		actual := JSONEntryMessage(now, e, headers)
+		if expected != actual {
+			t.Fatalf("expected '%v', got '%v'", expected, actual)
+		}
+	}
+}
+
+func TestJSONEntryMessageRequestID(t *testing.T) {
+	now := func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+	e := Entry{
+		Request:   httptest.NewRequest(http.MethodGet, "/", nil),
+		Status:    http.StatusOK,
+		RequestID: "abc-123",
+	}
+	expected := `{"time":"2000-01-02T03:04:05Z","src":"rl","status":200,"http_2xx":1,"len":0,"ms":0,"method":"GET","path":"/","req_id":"abc-123","req_len":0,"req_read_ms":0}` + "\n"
+	actual := JSONEntryMessage(now, e, nil)
+	if expected != actual {
+		t.Errorf("expected '%v', got '%v'", expected, actual)
+	}
+}
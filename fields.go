@@ -0,0 +1,60 @@
+package responselogger
+
+import (
+	"context"
+	"sync"
+)
+
+type fieldsKey struct{}
+
+// fieldBag holds the fields added to a request's log entry by downstream handlers.
+type fieldBag struct {
+	m      sync.Mutex
+	fields []Field
+}
+
+func withFieldBag(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, &fieldBag{})
+}
+
+// AddField adds a string field to the log entry of the request that ctx belongs to, e.g. a user ID. It has no
+// effect if the request isn't being handled by a Handler.
+func AddField(ctx context.Context, key, value string) {
+	AddValue(ctx, key, String(value))
+}
+
+// AddValue adds a typed field to the log entry of the request that ctx belongs to, e.g. whether the cache was hit.
+// Adding a key which has already been added replaces its value. Keys of the core fields written by
+// JSONEntryMessage, such as "status", are not logged. It has no effect if the request isn't being
+// handled by a Handler.
+func AddValue(ctx context.Context, key string, v Value) {
+	fb, ok := ctx.Value(fieldsKey{}).(*fieldBag)
+	if !ok {
+		return
+	}
+	fb.m.Lock()
+	defer fb.m.Unlock()
+	for i := range fb.fields {
+		if fb.fields[i].Key == key {
+			fb.fields[i].Value = v
+			return
+		}
+	}
+	fb.fields = append(fb.fields, Field{Key: key, Value: v})
+}
+
+// Fields returns a copy of the fields added to the log entry of the request that ctx belongs to.
+func Fields(ctx context.Context) []Field {
+	fb, ok := ctx.Value(fieldsKey{}).(*fieldBag)
+	if !ok {
+		return nil
+	}
+	fb.m.Lock()
+	defer fb.m.Unlock()
+	if len(fb.fields) == 0 {
+		return nil
+	}
+	fields := make([]Field, len(fb.fields))
+	copy(fields, fb.fields)
+	return fields
+}
@@ -0,0 +1,170 @@
+package responselogger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddField(t *testing.T) {
+	var entry Entry
+	h := Handler{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			AddField(r.Context(), "user", "123")
+			AddField(r.Context(), "cache", "hit")
+			AddField(r.Context(), "cache", "miss")
+		}),
+		EntryLogger: EntryLoggerFunc(func(e Entry) { entry = e }),
+		Skip:        SkipHealthEndpoint,
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	expected := []Field{
+		{Key: "user", Value: String("123")},
+		{Key: "cache", Value: String("miss")},
+	}
+	if !reflect.DeepEqual(entry.Fields, expected) {
+		t.Errorf("expected fields %v, got %v", expected, entry.Fields)
+	}
+}
+
+func TestFieldsAvailableToLogger(t *testing.T) {
+	var fields []Field
+	h := Handler{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			AddField(r.Context(), "tenant", "a")
+		}),
+		Logger: func(r *http.Request, status int, len int64, d time.Duration) {
+			fields = Fields(r.Context())
+		},
+		Skip: SkipHealthEndpoint,
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if len(fields) != 1 || fields[0].Key != "tenant" || fields[0].Value.String() != "a" {
+		t.Errorf("expected the tenant field to be available to the logger, got %v", fields)
+	}
+}
+
+func TestAddFieldWithoutHandler(t *testing.T) {
+	ctx := context.Background()
+	AddField(ctx, "key", "value")
+	if f := Fields(ctx); f != nil {
+		t.Errorf("expected no fields, got %v", f)
+	}
+}
+
+func TestJSONEntryMessageFields(t *testing.T) {
+	e := Entry{
+		Request: httptest.NewRequest(http.MethodGet, "/", nil),
+		Status:  http.StatusOK,
+		Fields: []Field{
+			{Key: "user", Value: String("123")},
+			{Key: "X-Header", Value: String("from context")},
+		},
+	}
+	actual := JSONEntryMessage(time.Now, e, map[string]string{"X-Header": "from request"})
+
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(actual), &m); err != nil {
+		t.Fatalf("failed to parse JSON message '%v': %v", actual, err)
+	}
+	if m["user"] != "123" {
+		t.Errorf("expected the user field to be logged, got %v", m)
+	}
+	if m["X-Header"] != "from request" {
+		t.Errorf("expected the given fields to take precedence, got %v", m)
+	}
+}
+
+// jsonKeys returns the top level keys of a JSON object, in order, including any duplicates.
+func jsonKeys(t *testing.T, s string) []string {
+	d := json.NewDecoder(strings.NewReader(s))
+	if _, err := d.Token(); err != nil {
+		t.Fatalf("failed to parse JSON message '%v': %v", s, err)
+	}
+	var keys []string
+	for d.More() {
+		k, err := d.Token()
+		if err != nil {
+			t.Fatalf("failed to parse JSON message '%v': %v", s, err)
+		}
+		keys = append(keys, k.(string))
+		var v json.RawMessage
+		if err := d.Decode(&v); err != nil {
+			t.Fatalf("failed to parse JSON message '%v': %v", s, err)
+		}
+	}
+	return keys
+}
+
+func TestJSONEntryMessageFieldsCannotDuplicateKeys(t *testing.T) {
+	now := func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+	e := Entry{
+		Request:             httptest.NewRequest(http.MethodGet, "/", nil),
+		Status:              http.StatusOK,
+		Length:              1,
+		Duration:            time.Second,
+		TTFB:                time.Millisecond,
+		RequestLength:       1,
+		RequestReadDuration: time.Millisecond,
+		ContextErr:          context.Canceled,
+		WriteErr:            errors.New("broken pipe"),
+		CopyErr:             errors.New("disk error"),
+		ClientClosed:        true,
+		Hijacked:            true,
+		ConnClosed:          true,
+		Running:             true,
+		Panic:               "oops",
+		Stack:               []string{"main.a /src/main.go:10"},
+		RequestID:           "abc",
+		Query:               "q=1",
+		QueryHash:           "hash",
+		RemoteIP:            "192.0.2.1",
+		InFlight:            1,
+		Trace:               TraceContext{TraceID: "t", SpanID: "s", ParentSpanID: "p"},
+		SampleRate:          10,
+	}
+	expected := JSONEntryMessage(now, e, nil)
+	keys := jsonKeys(t, expected)
+
+	fields := map[string]string{}
+	for _, k := range keys {
+		fields[k] = "from request"
+		e.Fields = append(e.Fields, Field{Key: k, Value: String("from context")})
+	}
+	actual := JSONEntryMessage(now, e, fields)
+	if !reflect.DeepEqual(jsonKeys(t, actual), keys) {
+		t.Errorf("expected keys %v, got %v", keys, jsonKeys(t, actual))
+	}
+	if actual != expected {
+		t.Errorf("expected '%v', got '%v'", expected, actual)
+	}
+}
+
+func TestAddValue(t *testing.T) {
+	var entry Entry
+	h := Handler{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			AddValue(r.Context(), "items", Int(3))
+			AddValue(r.Context(), "cache_hit", Bool(true))
+		}),
+		EntryLogger: EntryLoggerFunc(func(e Entry) { entry = e }),
+		Skip:        SkipHealthEndpoint,
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	expected := []Field{
+		{Key: "items", Value: Int(3)},
+		{Key: "cache_hit", Value: Bool(true)},
+	}
+	if !reflect.DeepEqual(entry.Fields, expected) {
+		t.Errorf("expected fields %v, got %v", expected, entry.Fields)
+	}
+}
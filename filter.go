@@ -0,0 +1,69 @@
+package responselogger
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// EntryFilter decides whether to log an entry once the response is complete, unlike Handler.Skip, which is
+// decided before the handler runs. It counts the entries it suppresses.
+type EntryFilter struct {
+	// Keep returns true for entries which should be logged.
+	Keep func(e Entry) bool
+
+	suppressed int64
+}
+
+// NewEntryFilter creates an EntryFilter which logs entries matching any of the keep functions, e.g.
+// NewEntryFilter(KeepErrors, KeepSlow(time.Millisecond*500)).
+func NewEntryFilter(keep ...func(e Entry) bool) *EntryFilter {
+	return &EntryFilter{
+		Keep: func(e Entry) bool {
+			for _, k := range keep {
+				if k(e) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// NewErrorFilter creates an EntryFilter which only logs server errors and panics.
+func NewErrorFilter() *EntryFilter {
+	return NewEntryFilter(KeepErrors)
+}
+
+// NewSlowFilter creates an EntryFilter which only logs requests taking at least the threshold.
+func NewSlowFilter(threshold time.Duration) *EntryFilter {
+	return NewEntryFilter(KeepSlow(threshold))
+}
+
+// KeepSlow returns true for entries whose duration is at least the threshold.
+func KeepSlow(threshold time.Duration) func(e Entry) bool {
+	return func(e Entry) bool {
+		return e.Duration >= threshold
+	}
+}
+
+// KeepStatus returns true for entries with a status in the range from min to max inclusive.
+func KeepStatus(min, max int) func(e Entry) bool {
+	return func(e Entry) bool {
+		return e.Status >= min && e.Status <= max
+	}
+}
+
+// Suppressed returns the number of entries which weren't logged.
+func (f *EntryFilter) Suppressed() int64 {
+	return atomic.LoadInt64(&f.suppressed)
+}
+
+// allow returns true if the entry should be logged, counting it if not. A nil EntryFilter allows all entries,
+// and entries logged by the watchdog are always allowed.
+func (f *EntryFilter) allow(e Entry) bool {
+	if f == nil || f.Keep == nil || e.Running || f.Keep(e) {
+		return true
+	}
+	atomic.AddInt64(&f.suppressed, 1)
+	return false
+}
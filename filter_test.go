@@ -0,0 +1,92 @@
+package responselogger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEntryFilter(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	tests := []struct {
+		name     string
+		filter   *EntryFilter
+		entry    Entry
+		expected bool
+	}{
+		{
+			name:     "nil filter",
+			filter:   nil,
+			entry:    Entry{Request: r, Status: http.StatusOK},
+			expected: true,
+		},
+		{
+			name:     "error filter with ok",
+			filter:   NewErrorFilter(),
+			entry:    Entry{Request: r, Status: http.StatusOK},
+			expected: false,
+		},
+		{
+			name:     "error filter with server error",
+			filter:   NewErrorFilter(),
+			entry:    Entry{Request: r, Status: http.StatusServiceUnavailable},
+			expected: true,
+		},
+		{
+			name:     "slow filter with fast request",
+			filter:   NewSlowFilter(time.Millisecond * 500),
+			entry:    Entry{Request: r, Status: http.StatusOK, Duration: time.Millisecond * 499},
+			expected: false,
+		},
+		{
+			name:     "slow filter with slow request",
+			filter:   NewSlowFilter(time.Millisecond * 500),
+			entry:    Entry{Request: r, Status: http.StatusOK, Duration: time.Millisecond * 500},
+			expected: true,
+		},
+		{
+			name:     "errors or slow with client error",
+			filter:   NewEntryFilter(KeepErrors, KeepSlow(time.Millisecond*500)),
+			entry:    Entry{Request: r, Status: http.StatusNotFound},
+			expected: false,
+		},
+		{
+			name:     "status range",
+			filter:   NewEntryFilter(KeepStatus(400, 499)),
+			entry:    Entry{Request: r, Status: http.StatusNotFound},
+			expected: true,
+		},
+	}
+
+	for _, test := range tests {
+		actual := test.filter.allow(test.entry)
+		if actual != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestHandlerFilter(t *testing.T) {
+	var logged []Entry
+	f := NewErrorFilter()
+	h := Handler{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/fail" {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+		}),
+		EntryLogger: EntryLoggerFunc(func(e Entry) { logged = append(logged, e) }),
+		Filter:      f,
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+
+	if len(logged) != 1 || logged[0].Status != http.StatusInternalServerError {
+		t.Errorf("expected only the error to be logged, got %+v", logged)
+	}
+	if f.Suppressed() != 2 {
+		t.Errorf("expected 2 suppressed entries, got %d", f.Suppressed())
+	}
+}
@@ -1,12 +1,17 @@
 package responselogger
 
 import (
-	"bytes"
+	"context"
+	"fmt"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // Logger defines how HTTP requests are logged, e.g. to the console, or in JSON format (see JSONLogger).
@@ -20,82 +25,311 @@ func JSONLogger(r *http.Request, status int, len int64, d time.Duration) {
 // NewJSONLoggerWithHeaders returns a logger that logs the given headers of an HTTP request.
 func NewJSONLoggerWithHeaders(h ...string) Logger {
 	return func(r *http.Request, status int, length int64, d time.Duration) {
-		m := make(map[string]string, len(h))
-		for _, name := range h {
-			m[name] = r.Header.Get(name)
-		}
-		os.Stderr.WriteString(JSONLogMessage(time.Now, r.Method, r.URL, status, length, d, m))
+		os.Stderr.WriteString(JSONLogMessage(time.Now, r.Method, r.URL, status, length, d, headerFields(r, h)))
 	}
 }
 
-var jsonEscapesMap = map[rune]string{
-	0x0022: `\"`,
-	0x005C: `\\`,
-	0x0008: `\b`,
-	0x000C: `\f`,
-	0x000A: `\n`,
-	0x000D: `\r`,
-	0x0009: `\n`,
+var jsonEscapes = map[byte]string{
+	'"':  `\"`,
+	'\\': `\\`,
+	'\b': `\b`,
+	'\f': `\f`,
+	'\n': `\n`,
+	'\r': `\r`,
+	'\t': `\t`,
 }
 
+const hexDigits = "0123456789abcdef"
+
+// jsonEscape escapes s for use within a JSON string, as per RFC 8259. Invalid UTF-8 is replaced with U+FFFD, and
+// U+2028 and U+2029 are escaped so that the output is also valid JavaScript.
 func jsonEscape(s string) string {
-	b := bytes.NewBufferString("")
-	for _, r := range s {
-		// Skip control chars, they're not valid in URLs either.
-		if r >= 0x0000 && r <= 0x001F {
+	if !needsEscape(s) {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if replacement, ok := jsonEscapes[c]; ok {
+				b.WriteString(replacement)
+			} else if c < 0x20 {
+				b.WriteString(`\u00`)
+				b.WriteByte(hexDigits[c>>4])
+				b.WriteByte(hexDigits[c&0xF])
+			} else {
+				b.WriteByte(c)
+			}
+			i++
 			continue
 		}
-		// Replace others with escaped values.
-		if replacement, ok := jsonEscapesMap[r]; ok {
-			b.WriteString(replacement)
-			continue
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b.WriteString(`\ufffd`)
+		case r == '\u2028':
+			b.WriteString(`\u2028`)
+		case r == '\u2029':
+			b.WriteString(`\u2029`)
+		default:
+			b.WriteString(s[i : i+size])
 		}
-		// Use the character.
-		b.WriteRune(r)
+		i += size
 	}
 	return b.String()
 }
 
+// needsEscape returns true if s contains anything which jsonEscape would change.
+func needsEscape(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c == '"' || c == '\\' || c >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
+
 // JSONLogMessage formats a log message to JSON.
 func JSONLogMessage(now func() time.Time, method string, u *url.URL, status int, length int64, d time.Duration, fields map[string]string) string {
-	c := "http_" + strconv.Itoa(status/100) + "xx"
-	s := `{` +
-		`"time":"` + now().UTC().Format(time.RFC3339) + `",` +
-		`"src":"rl",` +
-		`"status":` + strconv.Itoa(status) + `,` +
-		`"` + c + `":1,` +
-		`"len":` + strconv.FormatInt(length, 10) + `,` +
-		`"ms":` + strconv.FormatInt(d.Nanoseconds()/1000000, 10) + `,` +
-		`"method":"` + jsonEscape(method) + `",` +
-		`"path":"` + jsonEscape(u.Path) + `"`
-	for k, v := range fields {
-		s += `,"` + k + `":"` + v + `"`
-	}
-	return s + "}\n"
+	e := Entry{
+		Request:  &http.Request{Method: method, URL: u},
+		Status:   status,
+		Length:   length,
+		Duration: d,
+	}
+	return jsonEntryMessage(now, e, fields, false)
+}
+
+// jsonObject builds a JSON object. Each key is only written once, so that fields added later can't duplicate or
+// replace those already written.
+type jsonObject struct {
+	b       strings.Builder
+	written map[string]bool
+}
+
+// add writes the key with a value which is already encoded as JSON, unless the key has already been written.
+func (o *jsonObject) add(key, value string) {
+	if o.written[key] {
+		return
+	}
+	if o.written == nil {
+		o.written = make(map[string]bool)
+		o.b.WriteString("{")
+	} else {
+		o.b.WriteString(",")
+	}
+	o.written[key] = true
+	o.b.WriteString(`"` + jsonEscape(key) + `":` + value)
+}
+
+// addString writes the key with a string value.
+func (o *jsonObject) addString(key, value string) {
+	o.add(key, `"`+jsonEscape(value)+`"`)
+}
+
+// String returns the object followed by a newline.
+func (o *jsonObject) String() string {
+	if o.written == nil {
+		return "{}\n"
+	}
+	return o.b.String() + "}\n"
+}
+
+// JSONEntryMessage formats a log entry to JSON. The core fields are written first, then the given fields sorted by
+// key, then the entry's ResponseHeader sorted by name, then the entry's Fields in the order they were added. If the
+// same key is used more than once, only the first is written, so the core fields can't be replaced.
+func JSONEntryMessage(now func() time.Time, e Entry, fields map[string]string) string {
+	return jsonEntryMessage(now, e, fields, true)
+}
+
+// jsonEntryMessage formats a log entry to JSON. The request length and read duration are only written if
+// requestSide is true, as JSONLogMessage doesn't receive them.
+func jsonEntryMessage(now func() time.Time, e Entry, fields map[string]string, requestSide bool) string {
+	var o jsonObject
+	o.addString("time", now().UTC().Format(time.RFC3339))
+	o.addString("src", "rl")
+	o.add("status", strconv.Itoa(e.Status))
+	// A closed connection isn't a response, so it's left out of the status metrics.
+	if e.Status > 0 && !e.ConnClosed {
+		o.add("http_"+strconv.Itoa(e.Status/100)+"xx", "1")
+	}
+	o.add("len", strconv.FormatInt(e.Length, 10))
+	ms := strconv.FormatInt(e.Duration.Nanoseconds()/1000000, 10)
+	// A running request's duration isn't final, and a closed connection's covers more than the response, so
+	// they're written under other keys to keep them out of the duration metrics.
+	if !e.Running && !e.ConnClosed {
+		o.add("ms", ms)
+	}
+	o.addString("method", e.Request.Method)
+	o.addString("path", e.Request.URL.Path)
+	if e.RequestID != "" {
+		o.addString("req_id", e.RequestID)
+	}
+	if e.Query != "" {
+		o.addString("query", e.Query)
+	}
+	if e.QueryHash != "" {
+		o.addString("query_hash", e.QueryHash)
+	}
+	if e.RemoteIP != "" {
+		o.addString("remote_ip", e.RemoteIP)
+	}
+	if e.Trace.TraceID != "" {
+		o.addString("trace_id", e.Trace.TraceID)
+		o.addString("span_id", e.Trace.SpanID)
+		if e.Trace.ParentSpanID != "" {
+			o.addString("parent_span_id", e.Trace.ParentSpanID)
+		}
+	}
+	if e.InFlight > 0 {
+		o.add("in_flight", strconv.Itoa(e.InFlight))
+	}
+	if e.TTFB > 0 {
+		o.add("ttfb_ms", strconv.FormatInt(e.TTFB.Nanoseconds()/1000000, 10))
+	}
+	if e.ClientClosed {
+		o.add("client_closed", "true")
+	}
+	if e.ContextErr != nil {
+		o.addString("ctx_err", e.ContextErr.Error())
+	}
+	if e.WriteErr != nil {
+		o.addString("write_err", e.WriteErr.Error())
+	}
+	if e.CopyErr != nil {
+		o.addString("copy_err", e.CopyErr.Error())
+	}
+	if requestSide {
+		o.add("req_len", strconv.FormatInt(e.RequestLength, 10))
+		o.add("req_read_ms", strconv.FormatInt(e.RequestReadDuration.Nanoseconds()/1000000, 10))
+	}
+	if e.Hijacked {
+		o.add("hijacked", "true")
+	}
+	if e.ConnClosed {
+		o.add("conn_closed", "true")
+		o.add("conn_ms", ms)
+		o.add("conn_read", strconv.FormatInt(e.ConnRead, 10))
+		o.add("conn_written", strconv.FormatInt(e.ConnWritten, 10))
+	}
+	if e.Running {
+		o.add("running", "true")
+		o.add("elapsed_ms", ms)
+	}
+	if e.Panic != nil {
+		o.addString("panic", fmt.Sprint(e.Panic))
+	}
+	if len(e.Stack) > 0 {
+		o.add("stack", Strings(e.Stack...).json())
+	}
+	if e.SampleRate > 0 {
+		o.add("sample_rate", strconv.Itoa(e.SampleRate))
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		o.addString(k, fields[k])
+	}
+	keys = keys[:0]
+	for name := range e.ResponseHeader {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	for _, name := range keys {
+		o.addString(ResponseHeaderPrefix+name, strings.Join(e.ResponseHeader[name], ", "))
+	}
+	for _, f := range e.Fields {
+		o.add(f.Key, f.Value.json())
+	}
+	return o.String()
 }
 
 // Handler provides a way to log HTTP requests - the status code, http category, size and duration.
 type Handler struct {
-	Next   http.Handler
+	Next http.Handler
+	// Logger receives the request, status, length and duration. If set, it takes precedence over EntryLogger.
 	Logger Logger
-	Skip   func(r *http.Request) bool
+	// EntryLogger receives an Entry containing everything captured about the request.
+	EntryLogger EntryLogger
+	// Skip returns true for requests which shouldn't be logged. If nil, all requests are logged. See SkipRule for
+	// building rules.
+	Skip func(r *http.Request) bool
+	// Filter decides whether to log each entry once the response is complete, e.g. to only log errors or slow
+	// requests. If nil, all entries are logged.
+	Filter *EntryFilter
+	// LogHijackedConnClose logs an additional entry when a hijacked connection is closed, recording the
+	// connection lifetime and the bytes transferred over it. The entry is only passed to EntryLogger.
+	LogHijackedConnClose bool
+	// RecoverPanics recovers panics raised by Next and logs them as a 500 with the panic value and stack.
+	// The panic is then re-raised, unless PanicResponse is set. http.ErrAbortHandler is logged without a stack,
+	// keeping the status written so far, and always re-raised.
+	RecoverPanics bool
+	// PanicResponse writes the response after a recovered panic, if the handler has not already started one.
+	PanicResponse http.Handler
+	// RequestIDHeader is the header to read the request ID from. If the request doesn't have one, a new ID is
+	// generated. The ID is set on the response header, stored in the request context (see RequestID) and logged.
+	// If empty, request IDs are not used.
+	RequestIDHeader string
+	// NewRequestID generates request IDs. If nil, NewUUID is used.
+	NewRequestID func() string
+	// TraceContext reads the W3C traceparent and tracestate headers, stores them in the request context (see
+	// TraceFromContext) and logs the trace and span IDs.
+	TraceContext bool
+	// NewSpanIDs generates a new span ID for the server span, logging the caller's span ID as its parent. If the
+	// request isn't part of a trace, a new trace is started. Requires TraceContext.
+	NewSpanIDs bool
+	// TrustedProxies are the addresses of proxies, e.g. load balancers, whose ClientIPHeader is used to find the
+	// client's IP address. See ParsePrefixes and ClientIP.
+	TrustedProxies []netip.Prefix
+	// ClientIPHeader is the header which the trusted proxies set with the client's address, e.g. "X-Forwarded-For"
+	// or "Forwarded". If empty, the client's IP address is always the remote address of the connection.
+	ClientIPHeader string
+	// Query enables logging of the query string. If nil, only the path is logged.
+	Query *QueryLogging
+	// ResponseHeaders select the response headers to log, e.g. Headers("Content-Type", "Cache-Control"). They're
+	// captured and masked when the header is written, and logged with keys prefixed with ResponseHeaderPrefix.
+	// A header with more than one value is logged with the values separated by ", ".
+	ResponseHeaders []HeaderRule
+	// WatchdogThreshold, if greater than zero, logs an additional entry with "running":true for requests still
+	// being handled after the threshold, so that requests which hang are logged. The entry is only passed to
+	// EntryLogger.
+	WatchdogThreshold time.Duration
+	// WatchdogStack adds the stack of the handler's goroutine to the watchdog's entry. Finding it requires a dump
+	// of all goroutines, so it's only taken when a request exceeds WatchdogThreshold.
+	WatchdogStack bool
+	// InFlight, if not nil, tracks the requests being handled. The number in flight when each request starts is
+	// logged as "in_flight".
+	InFlight *InFlight
+	// Metrics, if not nil, collects request counts and histograms of the requests which aren't skipped. Filter and
+	// sampling don't affect them.
+	Metrics *Metrics
 }
 
 // NewHandler creates a new responselogger.Handler with default JSON logger which skips logging '/health' URLs.
 func NewHandler(next http.Handler) Handler {
 	return Handler{
-		Next:   next,
-		Logger: JSONLogger,
-		Skip:   SkipHealthEndpoint,
+		Next:            next,
+		EntryLogger:     JSONEntryLogger,
+		Skip:            SkipHealthEndpoint,
+		RequestIDHeader: DefaultRequestIDHeader,
+		TraceContext:    true,
+		ClientIPHeader:  DefaultClientIPHeader,
 	}
 }
 
 // NewHandlerWithHeaders creates a new responselogger.Handler with default JSON logger which skips logging '/health' URLs and logs the given headers.
 func NewHandlerWithHeaders(next http.Handler, h ...string) Handler {
 	return Handler{
-		Next:   next,
-		Logger: NewJSONLoggerWithHeaders(h...),
-		Skip:   SkipHealthEndpoint,
+		Next:            next,
+		EntryLogger:     NewJSONEntryLoggerWithHeaders(h...),
+		Skip:            SkipHealthEndpoint,
+		RequestIDHeader: DefaultRequestIDHeader,
+		TraceContext:    true,
+		ClientIPHeader:  DefaultClientIPHeader,
 	}
 }
 
@@ -106,54 +340,140 @@ func SkipHealthEndpoint(r *http.Request) bool {
 
 // ServeHTTP handles the HTTP request, keeping track of the status code used.
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if h.Skip(r) {
+	if h.Skip != nil && h.Skip(r) {
 		h.Next.ServeHTTP(w, r)
 		return
 	}
-	var written int64
-	var status = -1
-
-	wp := writerProxy{
-		h: func() http.Header {
-			return w.Header()
-		},
-		w: func(bytes []byte) (int, error) {
-			bw, err := w.Write(bytes)
-			written += int64(bw)
-			return bw, err
-		},
-		wh: func(code int) {
-			status = code
-			w.WriteHeader(code)
-		},
+	start := time.Now()
+	wp := &writerProxy{w: w, status: -1, start: start, ttfb: -1, captureHeaders: h.ResponseHeaders}
+	br := &bodyReader{ReadCloser: r.Body}
+	if r.Body != nil {
+		r.Body = br
+	}
+	ctx := withFieldBag(r.Context())
+	var requestID string
+	if h.RequestIDHeader != "" {
+		requestID = h.requestID(r.Header.Get(h.RequestIDHeader))
+		w.Header().Set(h.RequestIDHeader, requestID)
+		ctx = context.WithValue(ctx, requestIDKey{}, requestID)
+	}
+	var trace TraceContext
+	if h.TraceContext {
+		var ok bool
+		if trace, ok = h.traceContext(r.Header.Get("traceparent"), r.Header.Get("tracestate")); ok {
+			ctx = context.WithValue(ctx, traceContextKey{}, trace)
+		}
+	}
+	var inFlight int
+	if h.InFlight != nil {
+		var remove func()
+		remove, inFlight = h.InFlight.add(InFlightRequest{
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Start:     start,
+			RemoteIP:  ClientIP(r, h.ClientIPHeader, h.TrustedProxies),
+			RequestID: requestID,
+		})
+		defer remove()
+		ctx = context.WithValue(ctx, inFlightKey{}, inFlight)
+	}
+	r = r.WithContext(ctx)
+	if h.LogHijackedConnClose {
+		wp.onConnClose = func(read, written int64) {
+			h.log(Entry{
+				Request:     r,
+				Status:      http.StatusSwitchingProtocols,
+				Duration:    time.Now().Sub(start),
+				Hijacked:    true,
+				ConnClosed:  true,
+				ConnRead:    read,
+				ConnWritten: written,
+				RequestID:   requestID,
+				RemoteIP:    ClientIP(r, h.ClientIPHeader, h.TrustedProxies),
+				InFlight:    inFlight,
+				Trace:       trace,
+				Fields:      Fields(r.Context()),
+			})
+		}
+	}
+	if h.WatchdogThreshold > 0 {
+		defer h.watch(r, start, requestID, trace)()
+	}
+	if h.RecoverPanics {
+		defer h.recoverPanic(wp, br, r)
 	}
+	h.Next.ServeHTTP(wp.wrap(), r)
+	h.log(h.newEntry(r, wp, br))
+}
 
-	start := time.Now()
-	h.Next.ServeHTTP(wp, r)
-	duration := time.Now().Sub(start)
+// newEntry creates an Entry from the state captured while handling the request.
+func (h Handler) newEntry(r *http.Request, wp *writerProxy, br *bodyReader) Entry {
+	duration := time.Now().Sub(wp.start)
+	if !wp.hijacked {
+		// If nothing was written, the header is written when the handler returns.
+		wp.captureHeader()
+	}
 
-	// Use default status.
+	// Use default status. Hijacked connections usually write their own 101 response directly to the connection.
+	status := wp.status
+	if status == -1 && wp.hijacked {
+		status = http.StatusSwitchingProtocols
+	}
 	if status == -1 {
 		status = 200
 	}
+	ttfb := wp.ttfb
+	if ttfb == -1 {
+		ttfb = duration
+	}
 
-	h.Logger(r, status, written, duration)
-}
-
-type writerProxy struct {
-	h  func() http.Header
-	w  func(bytes []byte) (int, error)
-	wh func(status int)
-}
-
-func (wp writerProxy) Header() http.Header {
-	return wp.h()
-}
-
-func (wp writerProxy) Write(bytes []byte) (int, error) {
-	return wp.w(bytes)
+	ctxErr := r.Context().Err()
+	trace, _ := TraceFromContext(r.Context())
+	var query, queryHash string
+	if h.Query != nil && r.URL.RawQuery != "" {
+		query = h.Query.Format(r.URL.RawQuery)
+		if h.Query.HashRaw {
+			queryHash = h.Query.Hash(r.URL.RawQuery)
+		}
+	}
+	return Entry{
+		Request:             r,
+		Status:              status,
+		Length:              wp.written,
+		Duration:            duration,
+		TTFB:                ttfb,
+		Hijacked:            wp.hijacked,
+		RequestLength:       br.read,
+		RequestReadDuration: br.duration,
+		ContextErr:          ctxErr,
+		WriteErr:            wp.writeErr,
+		CopyErr:             wp.copyErr,
+		ClientClosed:        ctxErr == context.Canceled || wp.writeErr != nil,
+		RequestID:           RequestID(r.Context()),
+		RemoteIP:            ClientIP(r, h.ClientIPHeader, h.TrustedProxies),
+		InFlight:            inFlightCount(r.Context()),
+		Trace:               trace,
+		Query:               query,
+		QueryHash:           queryHash,
+		ResponseHeader:      wp.capturedHeader,
+		Fields:              Fields(r.Context()),
+	}
 }
 
-func (wp writerProxy) WriteHeader(status int) {
-	wp.wh(status)
+func (h Handler) log(e Entry) {
+	h.Metrics.observe(e)
+	if !h.Filter.allow(e) {
+		return
+	}
+	if h.Logger != nil {
+		// The Logger can't tell a running request or a closed connection from a response, so it only receives
+		// completed requests.
+		if !e.Running && !e.ConnClosed {
+			h.Logger(e.Request, e.Status, e.Length, e.Duration)
+		}
+		return
+	}
+	if h.EntryLogger != nil {
+		h.EntryLogger.LogEntry(e)
+	}
 }
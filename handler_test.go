@@ -1,13 +1,20 @@
 package responselogger
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
+	"unicode/utf8"
 )
 
 var httpResponseBody = "<html>\n<head>\n<title>Example</title>\n</head>\n<body>\nExample\n</body></html>"
@@ -320,6 +327,23 @@ func TestJSONLogMessage(t *testing.T) {
 			},
 			expected: `{"time":"2000-01-02T03:04:05Z","src":"rl","status":222,"http_2xx":1,"len":454,"ms":300,"method":"POST","path":"/test","field1":"v1","field2":"v2"}` + "\n",
 		},
+		{
+			name:     "additional fields are sorted",
+			now:      func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) },
+			method:   "GET",
+			url:      "/test",
+			status:   200,
+			written:  454,
+			duration: time.Millisecond * 300,
+			fields: map[string]string{
+				"zeta":  "z",
+				"alpha": "a",
+				"Mid":   "m",
+				"beta":  "b",
+				"gamma": "g",
+			},
+			expected: `{"time":"2000-01-02T03:04:05Z","src":"rl","status":200,"http_2xx":1,"len":454,"ms":300,"method":"GET","path":"/test","Mid":"m","alpha":"a","beta":"b","gamma":"g","zeta":"z"}` + "\n",
+		},
 	}
 
 	for _, test := range tests {
@@ -339,6 +363,42 @@ func TestJSONLogMessage(t *testing.T) {
 	}
 }
 
+func TestJSONLogMessageEscapesFields(t *testing.T) {
+	fields := map[string]string{
+		"X-\"Key\"": "value\"}\n,\"injected\":\"",
+	}
+	actual := JSONLogMessage(time.Now, "GET", &url.URL{Path: "/"}, http.StatusOK, 0, 0, fields)
+
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(actual), &m); err != nil {
+		t.Fatalf("failed to parse JSON message '%v': %v", actual, err)
+	}
+	if m[`X-"Key"`] != fields[`X-"Key"`] {
+		t.Errorf("expected the field to round trip, got %v", m)
+	}
+	if _, ok := m["injected"]; ok {
+		t.Errorf("expected the field value not to inject additional fields, got %v", m)
+	}
+}
+
+func FuzzJSONLogMessage(f *testing.F) {
+	f.Add("/test", "GET", "X-Header", "value")
+	f.Add("/test/\"q\"", "POST", "\t", "\n")
+	f.Add("\xff\u2028", "\x00", "\\", "\"")
+	f.Fuzz(func(t *testing.T, path, method, key, value string) {
+		u := &url.URL{Path: path}
+		actual := JSONLogMessage(time.Now, method, u, http.StatusOK, 10, time.Millisecond*100, map[string]string{key: value})
+
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(actual), &m); err != nil {
+			t.Fatalf("failed to parse JSON message '%v': %v", actual, err)
+		}
+		if utf8.ValidString(path) && key != "path" && m["path"] != path {
+			t.Errorf("expected path '%v', got '%v'", path, m["path"])
+		}
+	})
+}
+
 func BenchmarkJSONLogMessage(b *testing.B) {
 	m := map[string]string{
 		"a": "b",
@@ -394,11 +454,23 @@ func TestJSONEscape(t *testing.T) {
 		},
 		{
 			input:    "\n",
-			expected: "",
+			expected: `\n`,
 		},
 		{
 			input:    "\t",
-			expected: "",
+			expected: `\t`,
+		},
+		{
+			input:    "\x00\x1f",
+			expected: `\u0000\u001f`,
+		},
+		{
+			input:    "invalid\xffutf8",
+			expected: `invalid\ufffdutf8`,
+		},
+		{
+			input:    "line\u2028paragraph\u2029",
+			expected: `line\u2028paragraph\u2029`,
 		},
 		{
 			input:    "/test/section",
@@ -429,3 +501,191 @@ func TestJSONEscape(t *testing.T) {
 		}
 	}
 }
+
+func TestHandlerTTFBLogging(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		minTTFB time.Duration
+		maxTTFB time.Duration
+		minGap  time.Duration
+	}{
+		{
+			name: "write header then delay",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				time.Sleep(time.Millisecond * 100)
+				w.Write([]byte("OK"))
+			},
+			minTTFB: time.Duration(0),
+			maxTTFB: time.Millisecond * 50,
+			minGap:  time.Millisecond * 100,
+		},
+		{
+			name: "delay then write",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(time.Millisecond * 100)
+				w.Write([]byte("OK"))
+			},
+			minTTFB: time.Millisecond * 100,
+			maxTTFB: time.Millisecond * 200,
+		},
+		{
+			name: "no write",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(time.Millisecond * 100)
+			},
+			minTTFB: time.Millisecond * 100,
+			maxTTFB: time.Millisecond * 200,
+		},
+	}
+
+	for _, test := range tests {
+		var entry Entry
+		h := Handler{
+			Next:        test.handler,
+			EntryLogger: EntryLoggerFunc(func(e Entry) { entry = e }),
+			Skip:        SkipHealthEndpoint,
+		}
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test", nil))
+
+		if entry.TTFB < test.minTTFB || entry.TTFB > test.maxTTFB {
+			t.Errorf("%s: expected TTFB between %v and %v, but got %v", test.name, test.minTTFB, test.maxTTFB, entry.TTFB)
+		}
+		if entry.Duration-entry.TTFB < test.minGap {
+			t.Errorf("%s: expected duration %v to exceed TTFB %v by at least %v", test.name, entry.Duration, entry.TTFB, test.minGap)
+		}
+	}
+}
+
+func TestHandlerRequestBodyLogging(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		body           string
+		expectedLength int64
+	}{
+		{
+			name: "body read",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				ioutil.ReadAll(r.Body)
+			},
+			body:           "name=value",
+			expectedLength: int64(len("name=value")),
+		},
+		{
+			name: "body partially read",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				r.Body.Read(make([]byte, 4))
+			},
+			body:           "name=value",
+			expectedLength: 4,
+		},
+		{
+			name:           "body not read",
+			handler:        func(w http.ResponseWriter, r *http.Request) {},
+			body:           "name=value",
+			expectedLength: 0,
+		},
+	}
+
+	for _, test := range tests {
+		var entry Entry
+		h := Handler{
+			Next:        test.handler,
+			EntryLogger: EntryLoggerFunc(func(e Entry) { entry = e }),
+			Skip:        SkipHealthEndpoint,
+		}
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(test.body)))
+
+		if entry.RequestLength != test.expectedLength {
+			t.Errorf("%s: expected request length %d, got %d", test.name, test.expectedLength, entry.RequestLength)
+		}
+	}
+}
+
+type failingResponseWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w failingResponseWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("broken pipe")
+}
+
+func TestHandlerClientClosedLogging(t *testing.T) {
+	tests := []struct {
+		name                 string
+		w                    http.ResponseWriter
+		cancel               bool
+		expectedClientClosed bool
+		expectedContextErr   error
+		expectedWriteErr     bool
+		copyFrom             io.Reader
+		expectedCopyErr      bool
+	}{
+		{
+			name:                 "completed",
+			w:                    httptest.NewRecorder(),
+			expectedClientClosed: false,
+		},
+		{
+			name:                 "context cancelled",
+			w:                    httptest.NewRecorder(),
+			cancel:               true,
+			expectedClientClosed: true,
+			expectedContextErr:   context.Canceled,
+		},
+		{
+			name:                 "write failed",
+			w:                    failingResponseWriter{httptest.NewRecorder()},
+			expectedClientClosed: true,
+			expectedWriteErr:     true,
+		},
+		{
+			name: "copy source failed",
+			w: struct {
+				http.ResponseWriter
+				io.ReaderFrom
+			}{httptest.NewRecorder(), testReaderFrom{w: io.Discard}},
+			copyFrom:             iotest.ErrReader(errors.New("disk error")),
+			expectedClientClosed: false,
+			expectedCopyErr:      true,
+		},
+	}
+
+	for _, test := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		r := httptest.NewRequest(http.MethodGet, "/test", nil).WithContext(ctx)
+
+		var entry Entry
+		h := Handler{
+			Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if test.cancel {
+					cancel()
+				}
+				if test.copyFrom != nil {
+					io.Copy(w, test.copyFrom)
+					return
+				}
+				w.Write([]byte("OK"))
+			}),
+			EntryLogger: EntryLoggerFunc(func(e Entry) { entry = e }),
+			Skip:        SkipHealthEndpoint,
+		}
+		h.ServeHTTP(test.w, r)
+		cancel()
+
+		if entry.ClientClosed != test.expectedClientClosed {
+			t.Errorf("%s: expected client closed %v, got %v", test.name, test.expectedClientClosed, entry.ClientClosed)
+		}
+		if entry.ContextErr != test.expectedContextErr {
+			t.Errorf("%s: expected context error %v, got %v", test.name, test.expectedContextErr, entry.ContextErr)
+		}
+		if (entry.WriteErr != nil) != test.expectedWriteErr {
+			t.Errorf("%s: expected write error %v, got %v", test.name, test.expectedWriteErr, entry.WriteErr)
+		}
+		if (entry.CopyErr != nil) != test.expectedCopyErr {
+			t.Errorf("%s: expected copy error %v, got %v", test.name, test.expectedCopyErr, entry.CopyErr)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package responselogger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ResponseHeaderPrefix is added to the keys of logged response headers, so that they don't collide with request
+// headers of the same name.
+const ResponseHeaderPrefix = "resp_"
+
+// Mask transforms a header value before it's logged, e.g. to remove credentials.
+type Mask func(value string) string
+
+// HeaderRule configures how a header is logged.
+type HeaderRule struct {
+	// Name of the header, e.g. "Authorization".
+	Name string
+	// Mask transforms the value before it's logged. If nil, the value is logged unchanged.
+	Mask Mask
+}
+
+// Headers creates rules which log the named headers unchanged.
+func Headers(names ...string) []HeaderRule {
+	rules := make([]HeaderRule, len(names))
+	for i, name := range names {
+		rules[i] = HeaderRule{Name: name}
+	}
+	return rules
+}
+
+// RedactValue replaces the whole value.
+func RedactValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	return Redacted
+}
+
+// KeepScheme keeps only the authentication scheme of a value such as "Bearer eyJhbGciOi...", i.e. "Bearer". Values
+// without a scheme are redacted.
+func KeepScheme(value string) string {
+	if i := strings.IndexByte(value, ' '); i > 0 {
+		return value[:i]
+	}
+	return RedactValue(value)
+}
+
+// KeepPrefix keeps the first n characters of the value, replacing the rest with "...". A negative n is treated as 0.
+func KeepPrefix(n int) Mask {
+	if n < 0 {
+		n = 0
+	}
+	return func(value string) string {
+		var count int
+		for i := range value {
+			if count == n {
+				return value[:i] + "..."
+			}
+			count++
+		}
+		return value
+	}
+}
+
+// HashValue replaces the value with its hex encoded SHA-256 hash, so that values can be correlated without being
+// logged.
+func HashValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	h := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(h[:])
+}
+
+// headerRuleFields adds the headers selected by the rules to m.
+func headerRuleFields(m map[string]string, h http.Header, rules []HeaderRule) map[string]string {
+	if len(rules) == 0 {
+		return m
+	}
+	if m == nil {
+		m = make(map[string]string, len(rules))
+	}
+	for _, rule := range rules {
+		v := h.Get(rule.Name)
+		if rule.Mask != nil {
+			v = rule.Mask(v)
+		}
+		m[rule.Name] = v
+	}
+	return m
+}
+
+// NewJSONLoggerWithHeaderRules returns a logger that logs request headers according to the given rules.
+func NewJSONLoggerWithHeaderRules(rules ...HeaderRule) Logger {
+	return func(r *http.Request, status int, length int64, d time.Duration) {
+		fields := headerRuleFields(nil, r.Header, rules)
+		os.Stderr.WriteString(JSONLogMessage(time.Now, r.Method, r.URL, status, length, d, fields))
+	}
+}
@@ -0,0 +1,246 @@
+package responselogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMasks(t *testing.T) {
+	tests := []struct {
+		name     string
+		mask     Mask
+		input    string
+		expected string
+	}{
+		{
+			name:     "redact",
+			mask:     RedactValue,
+			input:    "Bearer abc",
+			expected: Redacted,
+		},
+		{
+			name:     "redact empty",
+			mask:     RedactValue,
+			input:    "",
+			expected: "",
+		},
+		{
+			name:     "keep scheme",
+			mask:     KeepScheme,
+			input:    "Bearer eyJhbGciOiJIUzI1NiJ9",
+			expected: "Bearer",
+		},
+		{
+			name:     "keep scheme without scheme",
+			mask:     KeepScheme,
+			input:    "eyJhbGciOiJIUzI1NiJ9",
+			expected: Redacted,
+		},
+		{
+			name:     "keep prefix",
+			mask:     KeepPrefix(4),
+			input:    "abcdefgh",
+			expected: "abcd...",
+		},
+		{
+			name:     "keep prefix of short value",
+			mask:     KeepPrefix(4),
+			input:    "abcd",
+			expected: "abcd",
+		},
+		{
+			name:     "keep prefix of multibyte value",
+			mask:     KeepPrefix(2),
+			input:    "中文字符",
+			expected: "中文...",
+		},
+		{
+			name:     "keep negative prefix",
+			mask:     KeepPrefix(-1),
+			input:    "abcd",
+			expected: "...",
+		},
+		{
+			name:     "hash",
+			mask:     HashValue,
+			input:    "secret",
+			expected: "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b",
+		},
+		{
+			name:     "hash empty",
+			mask:     HashValue,
+			input:    "",
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		actual := test.mask(test.input)
+		if actual != test.expected {
+			t.Errorf("%s: expected '%v', got '%v'", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestJSONEntryWriterHeaderRules(t *testing.T) {
+	buf := new(bytes.Buffer)
+	jw := NewJSONEntryWriter(buf, nil)
+	jw.RequestHeaders = []HeaderRule{
+		{Name: "Authorization", Mask: KeepScheme},
+		{Name: "Content-Type"},
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set("Authorization", "Bearer secret-token")
+	r.Header.Set("Content-Type", "application/json")
+	jw.LogEntry(Entry{Request: r, Status: http.StatusOK})
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("failed to parse JSON message '%v': %v", buf.String(), err)
+	}
+	expected := map[string]string{
+		"Authorization": "Bearer",
+		"Content-Type":  "application/json",
+	}
+	for k, v := range expected {
+		if m[k] != v {
+			t.Errorf("expected '%v' to be '%v', got '%v'", k, v, m[k])
+		}
+	}
+	if bytes.Contains(buf.Bytes(), []byte("secret")) {
+		t.Errorf("expected secrets not to be logged, got '%v'", buf.String())
+	}
+}
+
+func TestHandlerMasksResponseHeaders(t *testing.T) {
+	buf := new(bytes.Buffer)
+	h := Handler{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Set-Cookie", "session=secret")
+		}),
+		EntryLogger: NewJSONEntryWriter(buf, nil),
+		ResponseHeaders: []HeaderRule{
+			{Name: "content-type"},
+			{Name: "set-cookie", Mask: RedactValue},
+		},
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("failed to parse JSON message '%v': %v", buf.String(), err)
+	}
+	expected := map[string]string{
+		"resp_Content-Type": "text/html",
+		"resp_Set-Cookie":   Redacted,
+	}
+	for k, v := range expected {
+		if m[k] != v {
+			t.Errorf("expected '%v' to be '%v', got '%v'", k, v, m[k])
+		}
+	}
+	if _, ok := m["resp_set-cookie"]; ok {
+		t.Errorf("expected the header to be logged once, got '%v'", buf.String())
+	}
+	if bytes.Contains(buf.Bytes(), []byte("secret")) {
+		t.Errorf("expected secrets not to be logged, got '%v'", buf.String())
+	}
+}
+
+func TestHandlerResponseHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		expected http.Header
+	}{
+		{
+			name: "captured on WriteHeader",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("X-Other", "not logged")
+				w.WriteHeader(http.StatusOK)
+				w.Header().Set("Cache-Control", "set too late")
+			},
+			expected: http.Header{"Content-Type": {"text/plain"}},
+		},
+		{
+			name: "captured on Write",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", "no-cache")
+				w.Write([]byte("OK"))
+				w.Header().Set("Content-Type", "set too late")
+			},
+			expected: http.Header{"Cache-Control": {"no-cache"}},
+		},
+		{
+			name: "not captured on informational WriteHeader",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusEarlyHints)
+				w.Header().Set("Content-Type", "text/html")
+				w.WriteHeader(http.StatusOK)
+			},
+			expected: http.Header{"Content-Type": {"text/html"}},
+		},
+		{
+			name: "captured when the handler returns",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", "no-store")
+			},
+			expected: http.Header{"Cache-Control": {"no-store"}},
+		},
+	}
+
+	for _, test := range tests {
+		var entry Entry
+		h := Handler{
+			Next:            test.handler,
+			EntryLogger:     EntryLoggerFunc(func(e Entry) { entry = e }),
+			Skip:            SkipHealthEndpoint,
+			ResponseHeaders: Headers("content-type", "Cache-Control"),
+		}
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if !reflect.DeepEqual(entry.ResponseHeader, test.expected) {
+			t.Errorf("%s: expected response headers %v, got %v", test.name, test.expected, entry.ResponseHeader)
+		}
+		if entry.Status != http.StatusOK {
+			t.Errorf("%s: expected status %d, got %d", test.name, http.StatusOK, entry.Status)
+		}
+	}
+}
+
+func TestJSONEntryMessageResponseHeaders(t *testing.T) {
+	now := func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+	e := Entry{
+		Request: httptest.NewRequest(http.MethodGet, "/", nil),
+		Status:  http.StatusOK,
+		ResponseHeader: http.Header{
+			"X-Cache":      {"HIT"},
+			"Content-Type": {"text/html"},
+			"Set-Cookie":   {"a=1", "b=2"},
+		},
+	}
+	fields := map[string]string{"Content-Type": "application/json"}
+	expected := `{"time":"2000-01-02T03:04:05Z","src":"rl","status":200,"http_2xx":1,"len":0,"ms":0,"method":"GET","path":"/","req_len":0,"req_read_ms":0,"Content-Type":"application/json","resp_Content-Type":"text/html","resp_Set-Cookie":"a=1, b=2","resp_X-Cache":"HIT"}` + "\n"
+	actual := JSONEntryMessage(now, e, fields)
+	if expected != actual {
+		t.Errorf("expected '%v', got '%v'", expected, actual)
+	}
+}
+
+func BenchmarkJSONLogMessageWithHeaderRules(b *testing.B) {
+	logger := NewJSONLoggerWithHeaderRules(HeaderRule{Name: "Authorization", Mask: KeepScheme}, HeaderRule{Name: "b"})
+	r := httptest.NewRequest(http.MethodGet, "http://example.com/test", nil)
+	r.Header.Add("Authorization", "Bearer abc")
+	r.Header.Add("b", "2")
+	for i := 0; i < b.N; i++ {
+		logger(r, http.StatusOK, 1024, time.Millisecond*50)
+	}
+}
@@ -0,0 +1,83 @@
+package responselogger
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// InFlight tracks the requests currently being handled, see Handler.InFlight. The zero value is ready to use, and
+// one InFlight may be shared by several Handlers.
+type InFlight struct {
+	m        sync.Mutex
+	next     uint64
+	peak     int
+	requests map[uint64]InFlightRequest
+}
+
+// InFlightRequest describes a request which is being handled.
+type InFlightRequest struct {
+	Method    string
+	Path      string
+	Start     time.Time
+	RemoteIP  string
+	RequestID string
+}
+
+type inFlightKey struct{}
+
+// Count returns the number of requests currently being handled.
+func (f *InFlight) Count() int {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return len(f.requests)
+}
+
+// Peak returns the highest number of requests handled at once.
+func (f *InFlight) Peak() int {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.peak
+}
+
+// Snapshot returns the requests currently being handled, oldest first.
+func (f *InFlight) Snapshot() []InFlightRequest {
+	f.m.Lock()
+	requests := make([]InFlightRequest, 0, len(f.requests))
+	for _, r := range f.requests {
+		requests = append(requests, r)
+	}
+	f.m.Unlock()
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].Start.Before(requests[j].Start)
+	})
+	return requests
+}
+
+// add registers a request, returning a function to remove it and the number of requests in flight including it.
+func (f *InFlight) add(r InFlightRequest) (remove func(), count int) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if f.requests == nil {
+		f.requests = make(map[uint64]InFlightRequest)
+	}
+	id := f.next
+	f.next++
+	f.requests[id] = r
+	count = len(f.requests)
+	if count > f.peak {
+		f.peak = count
+	}
+	return func() {
+		f.m.Lock()
+		defer f.m.Unlock()
+		delete(f.requests, id)
+	}, count
+}
+
+// inFlightCount returns the number of requests in flight when the request started, or 0 if it's not tracked.
+func inFlightCount(ctx context.Context) int {
+	n, _ := ctx.Value(inFlightKey{}).(int)
+	return n
+}
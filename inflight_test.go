@@ -0,0 +1,103 @@
+package responselogger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInFlight(t *testing.T) {
+	f := &InFlight{}
+	start := time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC)
+
+	removeA, count := f.add(InFlightRequest{Method: http.MethodGet, Path: "/a", Start: start.Add(time.Second)})
+	if count != 1 {
+		t.Errorf("expected 1 request in flight, got %d", count)
+	}
+	removeB, count := f.add(InFlightRequest{Method: http.MethodPost, Path: "/b", Start: start})
+	if count != 2 {
+		t.Errorf("expected 2 requests in flight, got %d", count)
+	}
+
+	snapshot := f.Snapshot()
+	if len(snapshot) != 2 || snapshot[0].Path != "/b" || snapshot[1].Path != "/a" {
+		t.Errorf("expected the requests oldest first, got %+v", snapshot)
+	}
+
+	removeB()
+	if f.Count() != 1 {
+		t.Errorf("expected 1 request in flight after removing one, got %d", f.Count())
+	}
+	removeA()
+	if f.Count() != 0 {
+		t.Errorf("expected no requests in flight, got %d", f.Count())
+	}
+	if f.Peak() != 2 {
+		t.Errorf("expected a peak of 2, got %d", f.Peak())
+	}
+}
+
+func TestHandlerInFlight(t *testing.T) {
+	var m sync.Mutex
+	var logged []Entry
+	started := make(chan struct{})
+	release := make(chan struct{})
+	f := &InFlight{}
+	h := Handler{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/slow" {
+				close(started)
+				<-release
+			}
+		}),
+		EntryLogger: EntryLoggerFunc(func(e Entry) {
+			m.Lock()
+			defer m.Unlock()
+			logged = append(logged, e)
+		}),
+		InFlight: f,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+		close(done)
+	}()
+	<-started
+	if snapshot := f.Snapshot(); len(snapshot) != 1 || snapshot[0].Path != "/slow" {
+		t.Errorf("expected the slow request to be in flight, got %+v", snapshot)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fast", nil))
+	close(release)
+	<-done
+
+	if len(logged) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(logged))
+	}
+	if logged[0].Request.URL.Path != "/fast" || logged[0].InFlight != 2 {
+		t.Errorf("expected the fast request to start with 2 in flight, got %d", logged[0].InFlight)
+	}
+	if logged[1].InFlight != 1 {
+		t.Errorf("expected the slow request to start with 1 in flight, got %d", logged[1].InFlight)
+	}
+	if f.Count() != 0 || f.Peak() != 2 {
+		t.Errorf("expected 0 in flight with a peak of 2, got %d and %d", f.Count(), f.Peak())
+	}
+}
+
+func TestJSONEntryMessageInFlight(t *testing.T) {
+	now := func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+	e := Entry{
+		Request:  httptest.NewRequest(http.MethodGet, "/", nil),
+		Status:   http.StatusOK,
+		RemoteIP: "192.0.2.1",
+		InFlight: 3,
+	}
+	expected := `{"time":"2000-01-02T03:04:05Z","src":"rl","status":200,"http_2xx":1,"len":0,"ms":0,"method":"GET","path":"/","remote_ip":"192.0.2.1","in_flight":3,"req_len":0,"req_read_ms":0}` + "\n"
+	actual := JSONEntryMessage(now, e, nil)
+	if expected != actual {
+		t.Errorf("expected '%v', got '%v'", expected, actual)
+	}
+}
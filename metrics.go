@@ -0,0 +1,246 @@
+package responselogger
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/welldigital/responselogger/processor/urlpattern"
+)
+
+// DefaultDurationBuckets are the upper bounds, in seconds, of the request duration histogram.
+var DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets are the upper bounds, in bytes, of the response size histogram.
+var DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+
+// maxMetricsRoutes limits the number of routes tracked by Metrics. Further routes are counted as "other".
+const maxMetricsRoutes = 1000
+
+// clientErrorRoute is the route of requests answered with a 4xx status when Metrics.Route isn't set. The paths of
+// these requests are chosen by clients, e.g. scanners, so they'd otherwise fill every route.
+const clientErrorRoute = "4xx"
+
+// knownMethods are the methods used as labels. Others are counted as "other", so that clients can't create series.
+var knownMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// Metrics collects request counts by method, route and status class, and histograms of request duration and
+// response size, see Handler.Metrics. It's an http.Handler which serves them in the Prometheus text exposition
+// format. The exported fields must not be changed once the Metrics is in use.
+type Metrics struct {
+	// Route returns the route of the request, used as a label. If nil, the path is used, with IDs replaced by
+	// placeholders, and requests answered with a 4xx status are counted under the route "4xx". Once 1000 routes
+	// have been seen, further routes are counted as "other", so Route should only return a bounded set of values.
+	Route func(r *http.Request) string
+	// DurationBuckets are the upper bounds of the duration histogram in seconds. If nil, DefaultDurationBuckets
+	// is used.
+	DurationBuckets []float64
+	// SizeBuckets are the upper bounds of the size histogram in bytes. If nil, DefaultSizeBuckets is used.
+	SizeBuckets []float64
+
+	m         sync.Mutex
+	routes    map[string]bool
+	requests  map[requestSeries]int64
+	durations map[routeSeries]*histogram
+	sizes     map[routeSeries]*histogram
+}
+
+type routeSeries struct {
+	method string
+	route  string
+}
+
+type requestSeries struct {
+	routeSeries
+	class string
+}
+
+type histogram struct {
+	counts []int64
+	sum    float64
+	count  int64
+}
+
+func (h *histogram) observe(buckets []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]int64, len(buckets))
+	}
+	for i, b := range buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// NewMetrics creates Metrics with the default buckets.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		DurationBuckets: DefaultDurationBuckets,
+		SizeBuckets:     DefaultSizeBuckets,
+	}
+}
+
+// observe records a completed request. Entries logged by the watchdog and for closed hijacked connections aren't
+// counted, as they don't complete a request.
+func (m *Metrics) observe(e Entry) {
+	if m == nil || e.Running || e.ConnClosed {
+		return
+	}
+	method := e.Request.Method
+	if !knownMethods[method] {
+		method = "other"
+	}
+	var route string
+	switch {
+	case m.Route != nil:
+		route = m.Route(e.Request)
+	case e.Status >= 400 && e.Status < 500:
+		route = clientErrorRoute
+	default:
+		route = urlpattern.Extract(e.Request.URL.Path)
+	}
+	// The path is decoded, so it may not be valid UTF-8, which would make the whole exposition invalid.
+	route = strings.ToValidUTF8(route, "\uFFFD")
+
+	m.m.Lock()
+	defer m.m.Unlock()
+	if m.requests == nil {
+		m.routes = make(map[string]bool)
+		m.requests = make(map[requestSeries]int64)
+		m.durations = make(map[routeSeries]*histogram)
+		m.sizes = make(map[routeSeries]*histogram)
+	}
+	if !m.routes[route] {
+		if len(m.routes) >= maxMetricsRoutes {
+			route = otherRoute
+		}
+		m.routes[route] = true
+	}
+	rs := routeSeries{method: method, route: route}
+	m.requests[requestSeries{routeSeries: rs, class: strconv.Itoa(e.Status/100) + "xx"}]++
+	d, ok := m.durations[rs]
+	if !ok {
+		d = &histogram{}
+		m.durations[rs] = d
+	}
+	d.observe(m.durationBuckets(), e.Duration.Seconds())
+	s, ok := m.sizes[rs]
+	if !ok {
+		s = &histogram{}
+		m.sizes[rs] = s
+	}
+	s.observe(m.sizeBuckets(), float64(e.Length))
+}
+
+func (m *Metrics) durationBuckets() []float64 {
+	if m.DurationBuckets == nil {
+		return DefaultDurationBuckets
+	}
+	return m.DurationBuckets
+}
+
+func (m *Metrics) sizeBuckets() []float64 {
+	if m.SizeBuckets == nil {
+		return DefaultSizeBuckets
+	}
+	return m.SizeBuckets
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	m.write(bw)
+	bw.Flush()
+}
+
+func (m *Metrics) write(w *bufio.Writer) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	w.WriteString("# HELP http_requests_total Total number of HTTP requests by method, route and status class.\n")
+	w.WriteString("# TYPE http_requests_total counter\n")
+	requests := make([]requestSeries, 0, len(m.requests))
+	for k := range m.requests {
+		requests = append(requests, k)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].routeSeries != requests[j].routeSeries {
+			return requests[i].routeSeries.less(requests[j].routeSeries)
+		}
+		return requests[i].class < requests[j].class
+	})
+	for _, k := range requests {
+		w.WriteString("http_requests_total{" + k.labels() + `,status="` + k.class + `"} ` +
+			strconv.FormatInt(m.requests[k], 10) + "\n")
+	}
+
+	writeHistograms(w, "http_request_duration_seconds", "Duration of HTTP requests in seconds.",
+		m.durations, m.durationBuckets())
+	writeHistograms(w, "http_response_size_bytes", "Size of HTTP response bodies in bytes.",
+		m.sizes, m.sizeBuckets())
+}
+
+func writeHistograms(w *bufio.Writer, name, help string, hs map[routeSeries]*histogram, buckets []float64) {
+	w.WriteString("# HELP " + name + " " + help + "\n")
+	w.WriteString("# TYPE " + name + " histogram\n")
+	keys := make([]routeSeries, 0, len(hs))
+	for k := range hs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].less(keys[j])
+	})
+	for _, k := range keys {
+		h := hs[k]
+		labels := k.labels()
+		for i, b := range buckets {
+			w.WriteString(name + "_bucket{" + labels + `,le="` + formatFloat(b) + `"} ` +
+				strconv.FormatInt(h.counts[i], 10) + "\n")
+		}
+		w.WriteString(name + "_bucket{" + labels + `,le="+Inf"} ` + strconv.FormatInt(h.count, 10) + "\n")
+		w.WriteString(name + "_sum{" + labels + "} " + formatFloat(h.sum) + "\n")
+		w.WriteString(name + "_count{" + labels + "} " + strconv.FormatInt(h.count, 10) + "\n")
+	}
+}
+
+func (rs routeSeries) less(other routeSeries) bool {
+	if rs.route != other.route {
+		return rs.route < other.route
+	}
+	return rs.method < other.method
+}
+
+func (rs routeSeries) labels() string {
+	return `method="` + escapeLabel(rs.method) + `",route="` + escapeLabel(rs.route) + `"`
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a label value for the text exposition format.
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
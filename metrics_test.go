@@ -0,0 +1,141 @@
+package responselogger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestMetrics(t *testing.T) {
+	m := &Metrics{
+		DurationBuckets: []float64{0.1, 1},
+		SizeBuckets:     []float64{100},
+	}
+	m.observe(Entry{Request: httptest.NewRequest(http.MethodGet, "/user/1", nil), Status: http.StatusOK, Length: 50, Duration: time.Millisecond * 50})
+	m.observe(Entry{Request: httptest.NewRequest(http.MethodGet, "/user/2", nil), Status: http.StatusOK, Length: 150, Duration: time.Millisecond * 500})
+	m.observe(Entry{Request: httptest.NewRequest(http.MethodGet, "/user/3", nil), Status: http.StatusNotFound, Length: 10, Duration: time.Second * 2})
+	m.observe(Entry{Request: httptest.NewRequest("BREW", "/", nil), Status: http.StatusTeapot})
+	m.observe(Entry{Request: httptest.NewRequest(http.MethodGet, "/slow", nil), Running: true})
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	expected := `# HELP http_requests_total Total number of HTTP requests by method, route and status class.
+# TYPE http_requests_total counter
+http_requests_total{method="GET",route="/user/{integer}",status="2xx"} 2
+http_requests_total{method="GET",route="4xx",status="4xx"} 1
+http_requests_total{method="other",route="4xx",status="4xx"} 1
+# HELP http_request_duration_seconds Duration of HTTP requests in seconds.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{method="GET",route="/user/{integer}",le="0.1"} 1
+http_request_duration_seconds_bucket{method="GET",route="/user/{integer}",le="1"} 2
+http_request_duration_seconds_bucket{method="GET",route="/user/{integer}",le="+Inf"} 2
+http_request_duration_seconds_sum{method="GET",route="/user/{integer}"} 0.55
+http_request_duration_seconds_count{method="GET",route="/user/{integer}"} 2
+http_request_duration_seconds_bucket{method="GET",route="4xx",le="0.1"} 0
+http_request_duration_seconds_bucket{method="GET",route="4xx",le="1"} 0
+http_request_duration_seconds_bucket{method="GET",route="4xx",le="+Inf"} 1
+http_request_duration_seconds_sum{method="GET",route="4xx"} 2
+http_request_duration_seconds_count{method="GET",route="4xx"} 1
+http_request_duration_seconds_bucket{method="other",route="4xx",le="0.1"} 1
+http_request_duration_seconds_bucket{method="other",route="4xx",le="1"} 1
+http_request_duration_seconds_bucket{method="other",route="4xx",le="+Inf"} 1
+http_request_duration_seconds_sum{method="other",route="4xx"} 0
+http_request_duration_seconds_count{method="other",route="4xx"} 1
+# HELP http_response_size_bytes Size of HTTP response bodies in bytes.
+# TYPE http_response_size_bytes histogram
+http_response_size_bytes_bucket{method="GET",route="/user/{integer}",le="100"} 1
+http_response_size_bytes_bucket{method="GET",route="/user/{integer}",le="+Inf"} 2
+http_response_size_bytes_sum{method="GET",route="/user/{integer}"} 200
+http_response_size_bytes_count{method="GET",route="/user/{integer}"} 2
+http_response_size_bytes_bucket{method="GET",route="4xx",le="100"} 1
+http_response_size_bytes_bucket{method="GET",route="4xx",le="+Inf"} 1
+http_response_size_bytes_sum{method="GET",route="4xx"} 10
+http_response_size_bytes_count{method="GET",route="4xx"} 1
+http_response_size_bytes_bucket{method="other",route="4xx",le="100"} 1
+http_response_size_bytes_bucket{method="other",route="4xx",le="+Inf"} 1
+http_response_size_bytes_sum{method="other",route="4xx"} 0
+http_response_size_bytes_count{method="other",route="4xx"} 1
+`
+	if w.Body.String() != expected {
+		t.Errorf("expected '%v', got '%v'", expected, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("expected the text exposition content type, got '%v'", ct)
+	}
+}
+
+func TestMetricsRouteLimit(t *testing.T) {
+	m := NewMetrics()
+	m.Route = func(r *http.Request) string { return r.URL.Path }
+	for i := 0; i < maxMetricsRoutes+10; i++ {
+		m.observe(Entry{Request: httptest.NewRequest(http.MethodGet, "/"+strings.Repeat("a", i), nil), Status: http.StatusOK})
+	}
+
+	if len(m.routes) != maxMetricsRoutes+1 {
+		t.Errorf("expected %d routes including other, got %d", maxMetricsRoutes+1, len(m.routes))
+	}
+	other := m.requests[requestSeries{routeSeries: routeSeries{method: http.MethodGet, route: otherRoute}, class: "2xx"}]
+	if other != 10 {
+		t.Errorf("expected 10 requests counted as other, got %d", other)
+	}
+}
+
+func TestMetricsClientErrorRoute(t *testing.T) {
+	m := NewMetrics()
+	for i := 0; i < maxMetricsRoutes+10; i++ {
+		m.observe(Entry{Request: httptest.NewRequest(http.MethodGet, "/scan/"+strings.Repeat("a", i), nil), Status: http.StatusNotFound})
+	}
+	m.observe(Entry{Request: httptest.NewRequest(http.MethodGet, "/users", nil), Status: http.StatusOK})
+
+	if len(m.routes) != 2 {
+		t.Errorf("expected the 4xx route and /users, got %v", m.routes)
+	}
+	notFound := m.requests[requestSeries{routeSeries: routeSeries{method: http.MethodGet, route: clientErrorRoute}, class: "4xx"}]
+	if notFound != maxMetricsRoutes+10 {
+		t.Errorf("expected %d requests counted under the 4xx route, got %d", maxMetricsRoutes+10, notFound)
+	}
+}
+
+func TestMetricsInvalidUTF8Route(t *testing.T) {
+	m := NewMetrics()
+	m.observe(Entry{Request: httptest.NewRequest(http.MethodGet, "/%ff%fe", nil), Status: http.StatusOK})
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !utf8.ValidString(w.Body.String()) {
+		t.Errorf("expected the metrics to be valid UTF-8, got '%q'", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "route=\"/\uFFFD\"") {
+		t.Errorf("expected the invalid bytes to be replaced, got '%v'", w.Body.String())
+	}
+}
+
+func TestHandlerMetrics(t *testing.T) {
+	m := NewMetrics()
+	h := Handler{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}),
+		Filter:  NewSlowFilter(time.Hour),
+		Metrics: m,
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `http_requests_total{method="POST",route="/",status="5xx"} 1`+"\n") {
+		t.Errorf("expected the filtered request to be counted, got '%v'", w.Body.String())
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	actual := escapeLabel("a\\b\"c\nd")
+	expected := `a\\b\"c\nd`
+	if actual != expected {
+		t.Errorf("expected '%v', got '%v'", expected, actual)
+	}
+}
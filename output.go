@@ -0,0 +1,65 @@
+package responselogger
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// JSONEntryWriter is an EntryLogger which writes entries in JSON format to an io.Writer, e.g. a file, a buffer or
+// a pipe to a sidecar process.
+type JSONEntryWriter struct {
+	// RequestHeaders are the request headers to log.
+	RequestHeaders []HeaderRule
+
+	w       io.Writer
+	onError func(err error)
+	now     func() time.Time
+	m       sync.Mutex
+	errors  int64
+}
+
+// NewJSONEntryWriter creates a JSONEntryWriter which writes to w and logs the given headers of each HTTP request.
+// If onError is not nil, it's called with the error whenever a log line can't be written.
+func NewJSONEntryWriter(w io.Writer, onError func(err error), h ...string) *JSONEntryWriter {
+	return &JSONEntryWriter{
+		RequestHeaders: Headers(h...),
+		w:              w,
+		onError:        onError,
+		now:            time.Now,
+	}
+}
+
+// LogEntry writes the Entry as a line of JSON.
+func (jw *JSONEntryWriter) LogEntry(e Entry) {
+	fields := headerRuleFields(nil, e.Request.Header, jw.RequestHeaders)
+	jw.write(JSONEntryMessage(jw.now, e, fields))
+}
+
+func (jw *JSONEntryWriter) write(s string) {
+	jw.m.Lock()
+	_, err := io.WriteString(jw.w, s)
+	jw.m.Unlock()
+	if err != nil {
+		atomic.AddInt64(&jw.errors, 1)
+		if jw.onError != nil {
+			jw.onError(err)
+		}
+	}
+}
+
+// Errors returns the number of log lines which could not be written.
+func (jw *JSONEntryWriter) Errors() int64 {
+	return atomic.LoadInt64(&jw.errors)
+}
+
+// NewJSONLoggerWithWriter returns a logger that logs HTTP requests in JSON format to w, including the given headers.
+// If onError is not nil, it's called with the error whenever a log line can't be written.
+func NewJSONLoggerWithWriter(w io.Writer, onError func(err error), h ...string) Logger {
+	jw := NewJSONEntryWriter(w, onError, h...)
+	return func(r *http.Request, status int, length int64, d time.Duration) {
+		jw.write(JSONLogMessage(jw.now, r.Method, r.URL, status, length, d, headerFields(r, h)))
+	}
+}
@@ -0,0 +1,65 @@
+package responselogger
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type errorWriter struct{}
+
+func (errorWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestJSONEntryWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	jw := NewJSONEntryWriter(buf, nil, "X-Test")
+	jw.now = func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+
+	r := httptest.NewRequest(http.MethodGet, "/test", nil)
+	r.Header.Set("X-Test", "value")
+	jw.LogEntry(Entry{Request: r, Status: http.StatusOK, Length: 2, Duration: time.Millisecond * 10})
+
+	expected := `{"time":"2000-01-02T03:04:05Z","src":"rl","status":200,"http_2xx":1,"len":2,"ms":10,"method":"GET","path":"/test","req_len":0,"req_read_ms":0,"X-Test":"value"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("expected '%v', got '%v'", expected, buf.String())
+	}
+	if jw.Errors() != 0 {
+		t.Errorf("expected no errors, got %d", jw.Errors())
+	}
+}
+
+func TestJSONEntryWriterErrors(t *testing.T) {
+	var errs []error
+	jw := NewJSONEntryWriter(errorWriter{}, func(err error) { errs = append(errs, err) })
+
+	r := httptest.NewRequest(http.MethodGet, "/test", nil)
+	jw.LogEntry(Entry{Request: r, Status: http.StatusOK})
+	jw.LogEntry(Entry{Request: r, Status: http.StatusOK})
+
+	if jw.Errors() != 2 {
+		t.Errorf("expected 2 errors to be counted, got %d", jw.Errors())
+	}
+	if len(errs) != 2 || errs[0].Error() != "disk full" {
+		t.Errorf("expected 2 'disk full' errors to be passed to the callback, got %v", errs)
+	}
+}
+
+func TestJSONLoggerWithWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	var errs int
+	logger := NewJSONLoggerWithWriter(buf, func(err error) { errs++ })
+
+	logger(httptest.NewRequest(http.MethodGet, "/test", nil), http.StatusNotFound, 9, time.Millisecond)
+
+	if !bytes.Contains(buf.Bytes(), []byte(`"status":404`)) {
+		t.Errorf("expected a log line with status 404, got '%v'", buf.String())
+	}
+	if errs != 0 {
+		t.Errorf("expected no errors, got %d", errs)
+	}
+}
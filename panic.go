@@ -0,0 +1,61 @@
+package responselogger
+
+import (
+	"net/http"
+	"runtime"
+	"strconv"
+)
+
+// maxStackFrames is the maximum number of frames logged for a panic.
+const maxStackFrames = 32
+
+func (h Handler) recoverPanic(wp *writerProxy, br *bodyReader, r *http.Request) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	if p == http.ErrAbortHandler {
+		// The handler deliberately aborted the response, so it's logged with the status written so far, and
+		// re-raised without writing an error response so that net/http closes the connection.
+		e := h.newEntry(r, wp, br)
+		e.Panic = p
+		h.log(e)
+		panic(p)
+	}
+	stack := panicStack()
+	if h.PanicResponse != nil && wp.status == -1 && wp.written == 0 && !wp.hijacked {
+		h.PanicResponse.ServeHTTP(wp, r)
+	}
+	e := h.newEntry(r, wp, br)
+	e.Status = http.StatusInternalServerError
+	e.Panic = p
+	e.Stack = stack
+	h.log(e)
+	if h.PanicResponse == nil {
+		panic(p)
+	}
+}
+
+// panicStack returns the stack of the panicking goroutine, starting at the function which panicked.
+func panicStack() []string {
+	pc := make([]uintptr, 64)
+	n := runtime.Callers(1, pc)
+	frames := runtime.CallersFrames(pc[:n])
+	var stack []string
+	for {
+		f, more := frames.Next()
+		if f.Function == "runtime.gopanic" {
+			// Discard the frames added by the recovery itself.
+			stack = stack[:0]
+		} else {
+			stack = append(stack, f.Function+" "+f.File+":"+strconv.Itoa(f.Line))
+		}
+		if !more {
+			break
+		}
+	}
+	if len(stack) > maxStackFrames {
+		stack = stack[:maxStackFrames]
+	}
+	return stack
+}
@@ -0,0 +1,137 @@
+package responselogger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerRecoverPanicsRepanics(t *testing.T) {
+	var entry Entry
+	h := Handler{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("test panic")
+		}),
+		EntryLogger:   EntryLoggerFunc(func(e Entry) { entry = e }),
+		Skip:          SkipHealthEndpoint,
+		RecoverPanics: true,
+	}
+
+	func() {
+		defer func() {
+			if p := recover(); p != "test panic" {
+				t.Errorf("expected the panic to be re-raised, got %v", p)
+			}
+		}()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+
+	if entry.Status != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, entry.Status)
+	}
+	if entry.Panic != "test panic" {
+		t.Errorf("expected panic value to be logged, got %v", entry.Panic)
+	}
+	if len(entry.Stack) == 0 || !strings.Contains(entry.Stack[0], "TestHandlerRecoverPanicsRepanics") {
+		t.Errorf("expected stack to start at the panicking function, got %v", entry.Stack)
+	}
+	if len(entry.Stack) > maxStackFrames {
+		t.Errorf("expected at most %d stack frames, got %d", maxStackFrames, len(entry.Stack))
+	}
+}
+
+func TestHandlerRecoverPanicsWithResponse(t *testing.T) {
+	tests := []struct {
+		name           string
+		handler        http.HandlerFunc
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "panic before writing",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				panic("test panic")
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "panic response\n",
+		},
+		{
+			name: "panic after writing",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("partial"))
+				panic("test panic")
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "partial",
+		},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		var entry Entry
+		h := Handler{
+			Next:          test.handler,
+			EntryLogger:   EntryLoggerFunc(func(e Entry) { entry = e }),
+			Skip:          SkipHealthEndpoint,
+			RecoverPanics: true,
+			PanicResponse: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "panic response", http.StatusInternalServerError)
+			}),
+		}
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if w.Code != test.expectedStatus {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.expectedStatus, w.Code)
+		}
+		if w.Body.String() != test.expectedBody {
+			t.Errorf("%s: expected body '%s', got '%s'", test.name, test.expectedBody, w.Body.String())
+		}
+		if entry.Status != http.StatusInternalServerError {
+			t.Errorf("%s: expected status %d to be logged, got %d", test.name, http.StatusInternalServerError, entry.Status)
+		}
+		if entry.Length != int64(len(test.expectedBody)) {
+			t.Errorf("%s: expected length %d to be logged, got %d", test.name, len(test.expectedBody), entry.Length)
+		}
+	}
+}
+
+func TestHandlerRecoverPanicsAbortHandler(t *testing.T) {
+	var entry Entry
+	h := Handler{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("partial"))
+			panic(http.ErrAbortHandler)
+		}),
+		EntryLogger:   EntryLoggerFunc(func(e Entry) { entry = e }),
+		RecoverPanics: true,
+		PanicResponse: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("expected the panic response not to be written")
+		}),
+	}
+
+	w := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Errorf("expected http.ErrAbortHandler to be re-raised, got %v", p)
+			}
+		}()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+
+	if w.Body.String() != "partial" {
+		t.Errorf("expected only the partial body to be written, got '%v'", w.Body.String())
+	}
+	if entry.Status != http.StatusOK || entry.Length != int64(len("partial")) {
+		t.Errorf("expected the status and length written so far, got %d and %d", entry.Status, entry.Length)
+	}
+	if entry.Panic != http.ErrAbortHandler || entry.Stack != nil {
+		t.Errorf("expected the abort to be logged without a stack, got %v and %v", entry.Panic, entry.Stack)
+	}
+	if msg := JSONEntryMessage(time.Now, entry, nil); strings.Contains(msg, `"stack"`) {
+		t.Errorf("expected no stack in the log line, got '%v'", msg)
+	}
+}
@@ -0,0 +1,71 @@
+package responselogger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces the values of query string parameters and headers which must not be logged.
+const Redacted = "REDACTED"
+
+// DefaultDeniedParams are query string parameters which commonly contain credentials.
+var DefaultDeniedParams = []string{"access_token", "api_key", "apikey", "auth", "key", "password", "secret", "token"}
+
+// QueryLogging configures how the query string is logged.
+type QueryLogging struct {
+	// Allow lists the parameters which are logged with their values. Other parameters are logged, but their values
+	// are redacted. If empty, all parameters are allowed.
+	Allow []string
+	// Deny lists the parameters whose values are always redacted. Names are not case sensitive. If nil,
+	// DefaultDeniedParams is used. Set it to an empty slice to deny nothing.
+	Deny []string
+	// HashRaw logs the SHA-256 hash of the raw query string, so that identical queries can be grouped without
+	// logging their contents.
+	HashRaw bool
+}
+
+// Format returns the query string with the values of parameters which aren't allowed redacted, sorted by name.
+func (ql QueryLogging) Format(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	// Use whatever could be parsed, even if part of the query is invalid.
+	values, _ := url.ParseQuery(rawQuery)
+	for name, vs := range values {
+		if ql.allowed(name) {
+			continue
+		}
+		for i := range vs {
+			vs[i] = Redacted
+		}
+	}
+	return values.Encode()
+}
+
+// Hash returns the hex encoded SHA-256 hash of the raw query string.
+func (ql QueryLogging) Hash(rawQuery string) string {
+	h := sha256.Sum256([]byte(rawQuery))
+	return hex.EncodeToString(h[:])
+}
+
+func (ql QueryLogging) allowed(name string) bool {
+	deny := ql.Deny
+	if deny == nil {
+		deny = DefaultDeniedParams
+	}
+	if containsFold(deny, name) {
+		return false
+	}
+	return len(ql.Allow) == 0 || containsFold(ql.Allow, name)
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package responselogger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQueryLoggingFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		ql       QueryLogging
+		query    string
+		expected string
+	}{
+		{
+			name:     "empty",
+			expected: "",
+		},
+		{
+			name:     "all allowed",
+			query:    "q=a&page=9",
+			expected: "page=9&q=a",
+		},
+		{
+			name:     "denied",
+			ql:       QueryLogging{Deny: DefaultDeniedParams},
+			query:    "q=a&Token=secret&password=hunter2",
+			expected: "Token=REDACTED&password=REDACTED&q=a",
+		},
+		{
+			name:     "denied by default",
+			query:    "q=a&token=secret&password=hunter2",
+			expected: "password=REDACTED&q=a&token=REDACTED",
+		},
+		{
+			name:     "deny nothing",
+			ql:       QueryLogging{Deny: []string{}},
+			query:    "token=abc",
+			expected: "token=abc",
+		},
+		{
+			name:     "allow list",
+			ql:       QueryLogging{Allow: []string{"q"}},
+			query:    "q=a&email=someone%40example.com&email=other",
+			expected: "email=REDACTED&email=REDACTED&q=a",
+		},
+		{
+			name:     "deny takes precedence",
+			ql:       QueryLogging{Allow: []string{"token"}, Deny: []string{"token"}},
+			query:    "token=secret",
+			expected: "token=REDACTED",
+		},
+		{
+			name:     "values are escaped",
+			query:    "q=%22quoted%22+%26+more",
+			expected: "q=%22quoted%22+%26+more",
+		},
+		{
+			name:     "partially invalid",
+			query:    "q=a&bad=%zz",
+			expected: "q=a",
+		},
+	}
+
+	for _, test := range tests {
+		actual := test.ql.Format(test.query)
+		if actual != test.expected {
+			t.Errorf("%s: expected '%v', got '%v'", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestHandlerQueryLogging(t *testing.T) {
+	var entry Entry
+	h := Handler{
+		Next:        http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		EntryLogger: EntryLoggerFunc(func(e Entry) { entry = e }),
+		Skip:        SkipHealthEndpoint,
+		Query:       &QueryLogging{Deny: DefaultDeniedParams, HashRaw: true},
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/search?q=a&token=secret", nil))
+
+	if entry.Query != "q=a&token=REDACTED" {
+		t.Errorf("expected query 'q=a&token=REDACTED', got '%v'", entry.Query)
+	}
+	expectedHash := "04885c3292911321c0d9d7cd0f28f0c126b1a41d04095fbd24568adac78441f9"
+	if entry.QueryHash != expectedHash {
+		t.Errorf("expected query hash '%v', got '%v'", expectedHash, entry.QueryHash)
+	}
+}
+
+func TestHandlerQueryLoggingDisabled(t *testing.T) {
+	var entry Entry
+	h := Handler{
+		Next:        http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		EntryLogger: EntryLoggerFunc(func(e Entry) { entry = e }),
+		Skip:        SkipHealthEndpoint,
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/search?q=a", nil))
+
+	if entry.Query != "" || entry.QueryHash != "" {
+		t.Errorf("expected the query not to be logged, got '%v' and '%v'", entry.Query, entry.QueryHash)
+	}
+}
+
+func TestJSONEntryMessageQuery(t *testing.T) {
+	now := func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+	e := Entry{
+		Request:   httptest.NewRequest(http.MethodGet, "/search", nil),
+		Status:    http.StatusOK,
+		Query:     "q=a&token=REDACTED",
+		QueryHash: "abc",
+	}
+	expected := `{"time":"2000-01-02T03:04:05Z","src":"rl","status":200,"http_2xx":1,"len":0,"ms":0,"method":"GET","path":"/search","query":"q=a&token=REDACTED","query_hash":"abc","req_len":0,"req_read_ms":0}` + "\n"
+	actual := JSONEntryMessage(now, e, nil)
+	if expected != actual {
+		t.Errorf("expected '%v', got '%v'", expected, actual)
+	}
+}
@@ -0,0 +1,55 @@
+package responselogger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// DefaultRequestIDHeader is the header used by NewHandler to read and write request IDs.
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the maximum length of an incoming request ID. Longer IDs are replaced.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestID returns the ID of the request that ctx belongs to, or an empty string if the Handler isn't
+// configured to use request IDs.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewUUID returns a random (version 4) UUID, e.g. "1b4e28ba-2fa1-4d2e-883f-0016d3cca427".
+func NewUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+	return string(s[:])
+}
+
+// requestID returns the incoming request ID from the header, or a new one if it's missing or too long.
+func (h Handler) requestID(header string) string {
+	if header != "" && len(header) <= maxRequestIDLength {
+		return header
+	}
+	if h.NewRequestID != nil {
+		return h.NewRequestID()
+	}
+	return NewUUID()
+}
@@ -0,0 +1,96 @@
+package responselogger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewUUID(t *testing.T) {
+	a, b := NewUUID(), NewUUID()
+	if !uuidPattern.MatchString(a) {
+		t.Errorf("expected a version 4 UUID, got '%v'", a)
+	}
+	if a == b {
+		t.Errorf("expected unique UUIDs, got '%v' twice", a)
+	}
+}
+
+func TestHandlerRequestID(t *testing.T) {
+	tests := []struct {
+		name           string
+		header         string
+		incoming       string
+		newRequestID   func() string
+		expected       string
+		expectedFormat *regexp.Regexp
+	}{
+		{
+			name:     "incoming ID",
+			header:   DefaultRequestIDHeader,
+			incoming: "abc-123",
+			expected: "abc-123",
+		},
+		{
+			name:           "generated ID",
+			header:         DefaultRequestIDHeader,
+			expectedFormat: uuidPattern,
+		},
+		{
+			name:           "too long incoming ID is replaced",
+			header:         DefaultRequestIDHeader,
+			incoming:       strings.Repeat("a", maxRequestIDLength+1),
+			expectedFormat: uuidPattern,
+		},
+		{
+			name:         "custom generator and header",
+			header:       "X-Correlation-ID",
+			newRequestID: func() string { return "custom" },
+			expected:     "custom",
+		},
+		{
+			name:     "disabled",
+			incoming: "abc-123",
+			expected: "",
+		},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.incoming != "" {
+			r.Header.Set(DefaultRequestIDHeader, test.incoming)
+		}
+		w := httptest.NewRecorder()
+
+		var entry Entry
+		var fromContext string
+		h := Handler{
+			Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fromContext = RequestID(r.Context())
+			}),
+			EntryLogger:     EntryLoggerFunc(func(e Entry) { entry = e }),
+			Skip:            SkipHealthEndpoint,
+			RequestIDHeader: test.header,
+			NewRequestID:    test.newRequestID,
+		}
+		h.ServeHTTP(w, r)
+
+		if test.expectedFormat != nil {
+			if !test.expectedFormat.MatchString(entry.RequestID) {
+				t.Errorf("%s: unexpected request ID format '%v'", test.name, entry.RequestID)
+			}
+		} else if entry.RequestID != test.expected {
+			t.Errorf("%s: expected request ID '%v', got '%v'", test.name, test.expected, entry.RequestID)
+		}
+		if fromContext != entry.RequestID {
+			t.Errorf("%s: expected request ID '%v' in context, got '%v'", test.name, entry.RequestID, fromContext)
+		}
+		if test.header != "" && w.Header().Get(test.header) != entry.RequestID {
+			t.Errorf("%s: expected response header '%v', got '%v'", test.name, entry.RequestID, w.Header().Get(test.header))
+		}
+	}
+}
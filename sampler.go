@@ -0,0 +1,169 @@
+package responselogger
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/welldigital/responselogger/processor/urlpattern"
+)
+
+// DefaultSlowThreshold is the duration above which the samplers created by NewRatioSampler and NewRouteSampler
+// always log a request.
+const DefaultSlowThreshold = time.Second
+
+// maxSamplerRoutes limits the number of token buckets kept by a Sampler. Further routes share a single bucket.
+const maxSamplerRoutes = 1000
+
+const otherRoute = "other"
+
+// Sampler is an EntryLogger which passes a sample of entries to another EntryLogger, to reduce the volume of logs
+// from busy routes. Errors, slow requests and watchdog entries are always logged. Each logged entry records the
+// number of requests it represents in Entry.SampleRate, which is logged as "sample_rate", so that counts can be
+// reweighted.
+//
+// The sample rate is only written by EntryLoggers which format entries with JSONEntryMessage, such as
+// JSONEntryLogger and JSONEntryWriter. A Logger used as Next only receives the request, status, length and
+// duration, so its lines can't be reweighted.
+//
+// The exported fields must not be changed once the Sampler is in use.
+type Sampler struct {
+	// Next receives the sampled entries.
+	Next EntryLogger
+	// Rate logs one in every Rate entries. It's ignored if PerSecond is set.
+	Rate int
+	// PerSecond is the number of entries per second to log for each route, using a token bucket.
+	PerSecond float64
+	// Burst is the maximum number of entries logged at once for a route, when using PerSecond.
+	Burst int
+	// Route groups entries for PerSecond sampling. If nil, the method and path are used, with IDs in the path
+	// replaced by placeholders.
+	Route func(e Entry) string
+	// SlowThreshold is the duration above which entries are always logged. If zero, slow entries are sampled.
+	SlowThreshold time.Duration
+	// Keep returns true for entries which are always logged. If nil, KeepErrors is used.
+	Keep func(e Entry) bool
+
+	now     func() time.Time
+	m       sync.Mutex
+	seen    int
+	buckets map[string]*bucket
+}
+
+// bucket is a token bucket for a single route.
+type bucket struct {
+	tokens  float64
+	last    time.Time
+	skipped int
+}
+
+// NewRatioSampler creates a Sampler which logs one in every rate entries.
+func NewRatioSampler(next EntryLogger, rate int) *Sampler {
+	return &Sampler{
+		Next:          next,
+		Rate:          rate,
+		SlowThreshold: DefaultSlowThreshold,
+		now:           time.Now,
+	}
+}
+
+// NewRouteSampler creates a Sampler which logs up to perSecond entries per second for each route, allowing bursts
+// of up to burst entries.
+func NewRouteSampler(next EntryLogger, perSecond float64, burst int) *Sampler {
+	return &Sampler{
+		Next:          next,
+		PerSecond:     perSecond,
+		Burst:         burst,
+		SlowThreshold: DefaultSlowThreshold,
+		now:           time.Now,
+	}
+}
+
+// KeepErrors returns true for server errors and panics.
+func KeepErrors(e Entry) bool {
+	return e.Status >= http.StatusInternalServerError || e.Panic != nil
+}
+
+// RouteOf returns the method and path of the entry's request, with IDs replaced by placeholders, e.g.
+// "GET /user/{integer}".
+func RouteOf(e Entry) string {
+	return e.Request.Method + " " + urlpattern.Extract(e.Request.URL.Path)
+}
+
+// LogEntry passes the entry to Next if it's sampled.
+func (s *Sampler) LogEntry(e Entry) {
+	if rate, ok := s.sample(e); ok {
+		e.SampleRate = rate
+		s.Next.LogEntry(e)
+	}
+}
+
+// sample returns whether the entry should be logged, and the number of entries it represents.
+func (s *Sampler) sample(e Entry) (rate int, ok bool) {
+	keep := s.Keep
+	if keep == nil {
+		keep = KeepErrors
+	}
+	if e.Running || keep(e) || (s.SlowThreshold > 0 && e.Duration >= s.SlowThreshold) {
+		return 1, true
+	}
+	if s.PerSecond > 0 {
+		return s.sampleRoute(e)
+	}
+	if s.Rate <= 1 {
+		return 1, true
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.seen++
+	if s.seen < s.Rate {
+		return 0, false
+	}
+	s.seen = 0
+	return s.Rate, true
+}
+
+func (s *Sampler) sampleRoute(e Entry) (rate int, ok bool) {
+	routeOf := s.Route
+	if routeOf == nil {
+		routeOf = RouteOf
+	}
+	route := routeOf(e)
+	now := s.now
+	if now == nil {
+		now = time.Now
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.buckets == nil {
+		s.buckets = make(map[string]*bucket)
+	}
+	b, found := s.buckets[route]
+	if !found && len(s.buckets) >= maxSamplerRoutes {
+		route = otherRoute
+		b, found = s.buckets[route]
+	}
+	t := now()
+	burst := float64(s.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	if !found {
+		b = &bucket{tokens: burst, last: t}
+		s.buckets[route] = b
+	}
+	b.tokens += t.Sub(b.last).Seconds() * s.PerSecond
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = t
+	if b.tokens < 1 {
+		b.skipped++
+		return 0, false
+	}
+	b.tokens--
+	rate = b.skipped + 1
+	b.skipped = 0
+	return rate, true
+}
@@ -0,0 +1,128 @@
+package responselogger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type entryRecorder struct {
+	entries []Entry
+}
+
+func (er *entryRecorder) LogEntry(e Entry) {
+	er.entries = append(er.entries, e)
+}
+
+func TestRatioSampler(t *testing.T) {
+	er := &entryRecorder{}
+	s := NewRatioSampler(er, 10)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for i := 0; i < 100; i++ {
+		s.LogEntry(Entry{Request: r, Status: http.StatusOK})
+	}
+
+	if len(er.entries) != 10 {
+		t.Fatalf("expected 10 entries, got %d", len(er.entries))
+	}
+	for _, e := range er.entries {
+		if e.SampleRate != 10 {
+			t.Errorf("expected a sample rate of 10, got %d", e.SampleRate)
+		}
+	}
+}
+
+func TestSamplerKeepsErrorsAndSlowRequests(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	tests := []struct {
+		name     string
+		entry    Entry
+		expected int
+	}{
+		{
+			name:     "ok",
+			entry:    Entry{Request: r, Status: http.StatusOK},
+			expected: 0,
+		},
+		{
+			name:     "server error",
+			entry:    Entry{Request: r, Status: http.StatusBadGateway},
+			expected: 1,
+		},
+		{
+			name:     "panic",
+			entry:    Entry{Request: r, Status: http.StatusOK, Panic: "oops"},
+			expected: 1,
+		},
+		{
+			name:     "slow",
+			entry:    Entry{Request: r, Status: http.StatusOK, Duration: DefaultSlowThreshold},
+			expected: 1,
+		},
+	}
+
+	for _, test := range tests {
+		er := &entryRecorder{}
+		s := NewRatioSampler(er, 1000)
+		s.LogEntry(test.entry)
+		if len(er.entries) != test.expected {
+			t.Errorf("%s: expected %d entries, got %d", test.name, test.expected, len(er.entries))
+			continue
+		}
+		if test.expected == 1 && er.entries[0].SampleRate != 1 {
+			t.Errorf("%s: expected a sample rate of 1, got %d", test.name, er.entries[0].SampleRate)
+		}
+	}
+}
+
+func TestRouteSampler(t *testing.T) {
+	er := &entryRecorder{}
+	s := NewRouteSampler(er, 1, 2)
+	now := time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC)
+	s.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		s.LogEntry(Entry{Request: httptest.NewRequest(http.MethodGet, "/user/"+strconv.Itoa(i), nil), Status: http.StatusOK})
+	}
+	s.LogEntry(Entry{Request: httptest.NewRequest(http.MethodGet, "/other", nil), Status: http.StatusOK})
+	if len(er.entries) != 3 {
+		t.Fatalf("expected the burst for each route to be logged, got %d entries", len(er.entries))
+	}
+
+	now = now.Add(time.Second)
+	s.LogEntry(Entry{Request: httptest.NewRequest(http.MethodGet, "/user/5", nil), Status: http.StatusOK})
+	if len(er.entries) != 4 {
+		t.Fatalf("expected an entry to be logged once a token was available, got %d entries", len(er.entries))
+	}
+	if rate := er.entries[3].SampleRate; rate != 4 {
+		t.Errorf("expected the entry to represent the 3 skipped entries and itself, got %d", rate)
+	}
+}
+
+func TestJSONEntryMessageSampleRate(t *testing.T) {
+	now := func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+	e := Entry{
+		Request:    httptest.NewRequest(http.MethodGet, "/", nil),
+		Status:     http.StatusOK,
+		SampleRate: 10,
+	}
+	expected := `{"time":"2000-01-02T03:04:05Z","src":"rl","status":200,"http_2xx":1,"len":0,"ms":0,"method":"GET","path":"/","req_len":0,"req_read_ms":0,"sample_rate":10}` + "\n"
+	actual := JSONEntryMessage(now, e, nil)
+	if expected != actual {
+		t.Errorf("expected '%v', got '%v'", expected, actual)
+	}
+}
+
+func TestZeroValueRouteSampler(t *testing.T) {
+	er := &entryRecorder{}
+	s := &Sampler{Next: er, PerSecond: 5}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	s.LogEntry(Entry{Request: r, Status: http.StatusOK})
+	s.LogEntry(Entry{Request: r, Status: http.StatusOK})
+
+	if len(er.entries) != 1 {
+		t.Errorf("expected a burst of 1 entry, got %d", len(er.entries))
+	}
+}
@@ -0,0 +1,130 @@
+package responselogger
+
+import (
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DefaultProbeUserAgents are the User-Agent prefixes of common load balancer and orchestrator health checks.
+var DefaultProbeUserAgents = []string{"ELB-HealthChecker", "kube-probe", "GoogleHC"}
+
+// SkipRule returns true for requests which shouldn't be logged. It can be assigned to Handler.Skip, and combined
+// using And, Or and Not. A nil SkipRule doesn't match any request.
+type SkipRule func(r *http.Request) bool
+
+// Match returns the result of the rule, or false if the rule is nil.
+func (rule SkipRule) Match(r *http.Request) bool {
+	return rule != nil && rule(r)
+}
+
+// SkipPaths matches requests for any of the given paths exactly.
+func SkipPaths(paths ...string) SkipRule {
+	return func(r *http.Request) bool {
+		for _, p := range paths {
+			if r.URL.Path == p {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SkipPathPrefixes matches requests whose path starts with any of the given prefixes.
+func SkipPathPrefixes(prefixes ...string) SkipRule {
+	return func(r *http.Request) bool {
+		for _, p := range prefixes {
+			if strings.HasPrefix(r.URL.Path, p) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SkipPathGlobs matches requests whose path matches any of the given patterns, using the syntax of path.Match,
+// e.g. "/static/*.css". It panics if a pattern is malformed.
+func SkipPathGlobs(patterns ...string) SkipRule {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			panic("responselogger: invalid glob pattern " + p + ": " + err.Error())
+		}
+	}
+	return func(r *http.Request) bool {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, r.URL.Path); ok {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SkipPathRegexp matches requests whose path matches the regular expression.
+func SkipPathRegexp(re *regexp.Regexp) SkipRule {
+	return func(r *http.Request) bool {
+		return re.MatchString(r.URL.Path)
+	}
+}
+
+// SkipMethods matches requests using any of the given methods, e.g. http.MethodOptions.
+func SkipMethods(methods ...string) SkipRule {
+	return func(r *http.Request) bool {
+		for _, m := range methods {
+			if r.Method == m {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SkipUserAgents matches requests whose User-Agent header starts with any of the given prefixes.
+func SkipUserAgents(prefixes ...string) SkipRule {
+	return func(r *http.Request) bool {
+		ua := r.UserAgent()
+		for _, p := range prefixes {
+			if strings.HasPrefix(ua, p) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SkipProbes matches health checks made by the user agents in DefaultProbeUserAgents.
+func SkipProbes(r *http.Request) bool {
+	return SkipUserAgents(DefaultProbeUserAgents...)(r)
+}
+
+// And matches requests which match all of the rules.
+func And(rules ...SkipRule) SkipRule {
+	return func(r *http.Request) bool {
+		for _, rule := range rules {
+			if !rule.Match(r) {
+				return false
+			}
+		}
+		return len(rules) > 0
+	}
+}
+
+// Or matches requests which match any of the rules.
+func Or(rules ...SkipRule) SkipRule {
+	return func(r *http.Request) bool {
+		for _, rule := range rules {
+			if rule.Match(r) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not matches requests which don't match the rule.
+func Not(rule SkipRule) SkipRule {
+	return func(r *http.Request) bool {
+		return !rule.Match(r)
+	}
+}
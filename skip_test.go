@@ -0,0 +1,134 @@
+package responselogger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestSkipRules(t *testing.T) {
+	probe := httptest.NewRequest(http.MethodGet, "/ready", nil)
+	probe.Header.Set("User-Agent", "kube-probe/1.27")
+
+	tests := []struct {
+		name     string
+		rule     SkipRule
+		r        *http.Request
+		expected bool
+	}{
+		{
+			name:     "path",
+			rule:     SkipPaths("/health", "/ready"),
+			r:        httptest.NewRequest(http.MethodGet, "/ready", nil),
+			expected: true,
+		},
+		{
+			name:     "path does not match prefix",
+			rule:     SkipPaths("/health"),
+			r:        httptest.NewRequest(http.MethodGet, "/healthz", nil),
+			expected: false,
+		},
+		{
+			name:     "path prefix",
+			rule:     SkipPathPrefixes("/static/"),
+			r:        httptest.NewRequest(http.MethodGet, "/static/app.js", nil),
+			expected: true,
+		},
+		{
+			name:     "glob",
+			rule:     SkipPathGlobs("/static/*.css"),
+			r:        httptest.NewRequest(http.MethodGet, "/static/app.css", nil),
+			expected: true,
+		},
+		{
+			name:     "glob does not match subdirectory",
+			rule:     SkipPathGlobs("/static/*.css"),
+			r:        httptest.NewRequest(http.MethodGet, "/static/css/app.css", nil),
+			expected: false,
+		},
+		{
+			name:     "regexp",
+			rule:     SkipPathRegexp(regexp.MustCompile(`^/metrics(/|$)`)),
+			r:        httptest.NewRequest(http.MethodGet, "/metrics", nil),
+			expected: true,
+		},
+		{
+			name:     "method",
+			rule:     SkipMethods(http.MethodOptions, http.MethodHead),
+			r:        httptest.NewRequest(http.MethodOptions, "/", nil),
+			expected: true,
+		},
+		{
+			name:     "probe",
+			rule:     SkipProbes,
+			r:        probe,
+			expected: true,
+		},
+		{
+			name:     "not a probe",
+			rule:     SkipProbes,
+			r:        httptest.NewRequest(http.MethodGet, "/ready", nil),
+			expected: false,
+		},
+		{
+			name:     "and",
+			rule:     And(SkipMethods(http.MethodGet), SkipPathPrefixes("/static/")),
+			r:        httptest.NewRequest(http.MethodPost, "/static/upload", nil),
+			expected: false,
+		},
+		{
+			name:     "and without rules",
+			rule:     And(),
+			r:        httptest.NewRequest(http.MethodGet, "/", nil),
+			expected: false,
+		},
+		{
+			name:     "or",
+			rule:     Or(SkipHealthEndpoint, SkipProbes),
+			r:        httptest.NewRequest(http.MethodGet, "/health", nil),
+			expected: true,
+		},
+		{
+			name:     "not",
+			rule:     And(SkipPathPrefixes("/static/"), Not(SkipPaths("/static/index.html"))),
+			r:        httptest.NewRequest(http.MethodGet, "/static/index.html", nil),
+			expected: false,
+		},
+		{
+			name:     "nil",
+			rule:     Or(nil),
+			r:        httptest.NewRequest(http.MethodGet, "/", nil),
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		actual := test.rule(test.r)
+		if actual != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestSkipPathGlobsPanicsOnInvalidPattern(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for an invalid pattern")
+		}
+	}()
+	SkipPathGlobs("/[")
+}
+
+func TestHandlerWithoutSkip(t *testing.T) {
+	var logged int
+	h := Handler{
+		Next:        http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		EntryLogger: EntryLoggerFunc(func(e Entry) { logged++ }),
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	if logged != 1 {
+		t.Errorf("expected all requests to be logged when Skip is nil, got %d entries", logged)
+	}
+}
@@ -0,0 +1,101 @@
+package responselogger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// TraceContext is the W3C Trace Context (https://www.w3.org/TR/trace-context/) of a request.
+type TraceContext struct {
+	// TraceID is the 32 character hex ID of the whole trace.
+	TraceID string
+	// SpanID is the 16 character hex ID of the current span. Unless Handler.NewSpanIDs is set, this is the ID of
+	// the caller's span, taken from the traceparent header.
+	SpanID string
+	// ParentSpanID is the ID of the caller's span, if Handler.NewSpanIDs is set.
+	ParentSpanID string
+	// Flags are the trace flags, e.g. "01" if the trace is sampled.
+	Flags string
+	// State is the vendor specific tracestate header.
+	State string
+}
+
+// TraceParent formats the trace context as a traceparent header, for propagating the trace to other services.
+func (tc TraceContext) TraceParent() string {
+	return "00-" + tc.TraceID + "-" + tc.SpanID + "-" + tc.Flags
+}
+
+type traceContextKey struct{}
+
+// TraceFromContext returns the trace context of the request that ctx belongs to.
+func TraceFromContext(ctx context.Context) (tc TraceContext, ok bool) {
+	tc, ok = ctx.Value(traceContextKey{}).(TraceContext)
+	return
+}
+
+// ParseTraceParent parses a traceparent header, e.g. "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceParent(s string) (tc TraceContext, ok bool) {
+	parts := strings.SplitN(s, "-", 5)
+	if len(parts) < 4 {
+		return
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isHex(version, 2) || version == "ff" {
+		return
+	}
+	// Version 00 has exactly four parts, later versions may append more.
+	if version == "00" && len(parts) != 4 {
+		return
+	}
+	if !isHex(traceID, 32) || traceID == strings.Repeat("0", 32) {
+		return
+	}
+	if !isHex(spanID, 16) || spanID == strings.Repeat("0", 16) {
+		return
+	}
+	if !isHex(flags, 2) {
+		return
+	}
+	return TraceContext{TraceID: traceID, SpanID: spanID, Flags: flags}, true
+}
+
+// isHex returns true if s is n lowercase hex characters.
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !(s[i] >= '0' && s[i] <= '9' || s[i] >= 'a' && s[i] <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// traceContext reads the trace context of the request, starting a new span if h.NewSpanIDs is set.
+func (h Handler) traceContext(traceParent, traceState string) (tc TraceContext, ok bool) {
+	tc, ok = ParseTraceParent(traceParent)
+	if ok {
+		tc.State = traceState
+	}
+	if !h.NewSpanIDs {
+		return
+	}
+	if ok {
+		tc.ParentSpanID = tc.SpanID
+	} else {
+		tc = TraceContext{TraceID: randomHex(16), Flags: "00"}
+	}
+	tc.SpanID = randomHex(8)
+	return tc, true
+}
@@ -0,0 +1,165 @@
+package responselogger
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected TraceContext
+		ok       bool
+	}{
+		{
+			input:    "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			expected: TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Flags: "01"},
+			ok:       true,
+		},
+		{
+			input:    "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future",
+			expected: TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Flags: "00"},
+			ok:       true,
+		},
+		{
+			input: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		},
+		{
+			input: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		{
+			input: "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		},
+		{
+			input: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		},
+		{
+			input: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		},
+		{
+			input: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		},
+		{
+			input: "",
+		},
+	}
+
+	for _, test := range tests {
+		actual, ok := ParseTraceParent(test.input)
+		if ok != test.ok {
+			t.Errorf("'%v': expected ok %v, got %v", test.input, test.ok, ok)
+		}
+		if actual != test.expected {
+			t.Errorf("'%v': expected %+v, got %+v", test.input, test.expected, actual)
+		}
+	}
+}
+
+func TestHandlerTraceContext(t *testing.T) {
+	tests := []struct {
+		name               string
+		traceParent        string
+		newSpanIDs         bool
+		expectedTraceID    string
+		expectedSpanID     string
+		expectedParentSpan string
+		expectNewTrace     bool
+	}{
+		{
+			name:            "incoming trace",
+			traceParent:     "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			expectedTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+			expectedSpanID:  "00f067aa0ba902b7",
+		},
+		{
+			name: "no trace",
+		},
+		{
+			name:               "new span",
+			traceParent:        "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			newSpanIDs:         true,
+			expectedTraceID:    "4bf92f3577b34da6a3ce929d0e0e4736",
+			expectedParentSpan: "00f067aa0ba902b7",
+		},
+		{
+			name:           "new trace",
+			newSpanIDs:     true,
+			expectNewTrace: true,
+		},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.traceParent != "" {
+			r.Header.Set("traceparent", test.traceParent)
+			r.Header.Set("tracestate", "vendor=value")
+		}
+
+		var entry Entry
+		var fromContext TraceContext
+		h := Handler{
+			Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fromContext, _ = TraceFromContext(r.Context())
+			}),
+			EntryLogger:  EntryLoggerFunc(func(e Entry) { entry = e }),
+			Skip:         SkipHealthEndpoint,
+			TraceContext: true,
+			NewSpanIDs:   test.newSpanIDs,
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+
+		if fromContext != entry.Trace {
+			t.Errorf("%s: expected the context to contain %+v, got %+v", test.name, entry.Trace, fromContext)
+		}
+		if test.expectNewTrace {
+			if !isHex(entry.Trace.TraceID, 32) || !isHex(entry.Trace.SpanID, 16) || entry.Trace.ParentSpanID != "" {
+				t.Errorf("%s: expected a new trace, got %+v", test.name, entry.Trace)
+			}
+			continue
+		}
+		if entry.Trace.TraceID != test.expectedTraceID {
+			t.Errorf("%s: expected trace ID '%v', got '%v'", test.name, test.expectedTraceID, entry.Trace.TraceID)
+		}
+		if entry.Trace.ParentSpanID != test.expectedParentSpan {
+			t.Errorf("%s: expected parent span ID '%v', got '%v'", test.name, test.expectedParentSpan, entry.Trace.ParentSpanID)
+		}
+		if test.newSpanIDs {
+			if !isHex(entry.Trace.SpanID, 16) || entry.Trace.SpanID == test.expectedParentSpan {
+				t.Errorf("%s: expected a new span ID, got '%v'", test.name, entry.Trace.SpanID)
+			}
+		} else if entry.Trace.SpanID != test.expectedSpanID {
+			t.Errorf("%s: expected span ID '%v', got '%v'", test.name, test.expectedSpanID, entry.Trace.SpanID)
+		}
+		if test.traceParent != "" && entry.Trace.State != "vendor=value" {
+			t.Errorf("%s: expected trace state to be read, got '%v'", test.name, entry.Trace.State)
+		}
+	}
+}
+
+func TestTraceParent(t *testing.T) {
+	tc := TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Flags: "01"}
+	expected := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if tc.TraceParent() != expected {
+		t.Errorf("expected '%v', got '%v'", expected, tc.TraceParent())
+	}
+}
+
+func TestJSONEntryMessageTrace(t *testing.T) {
+	now := func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+	e := Entry{
+		Request: httptest.NewRequest(http.MethodGet, "/", nil),
+		Status:  http.StatusOK,
+		Trace: TraceContext{
+			TraceID:      "4bf92f3577b34da6a3ce929d0e0e4736",
+			SpanID:       "b7ad6b7169203331",
+			ParentSpanID: "00f067aa0ba902b7",
+		},
+	}
+	expected := `{"time":"2000-01-02T03:04:05Z","src":"rl","status":200,"http_2xx":1,"len":0,"ms":0,"method":"GET","path":"/","trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"b7ad6b7169203331","parent_span_id":"00f067aa0ba902b7","req_len":0,"req_read_ms":0}` + "\n"
+	actual := JSONEntryMessage(now, e, nil)
+	if expected != actual {
+		t.Errorf("expected '%v', got '%v'", expected, actual)
+	}
+}
@@ -0,0 +1,146 @@
+package responselogger
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type valueKind int
+
+const (
+	stringKind valueKind = iota
+	intKind
+	floatKind
+	boolKind
+	durationKind
+	stringsKind
+	objectKind
+)
+
+// Value is a typed field value. Numbers and booleans are written to JSON without quotes, so that they can be
+// compared numerically, e.g. by CloudWatch metric filters.
+type Value struct {
+	kind valueKind
+	s    string
+	i    int64
+	f    float64
+	ss   []string
+	obj  []Field
+}
+
+// Field is a named Value.
+type Field struct {
+	Key   string
+	Value Value
+}
+
+// String creates a string Value.
+func String(s string) Value {
+	return Value{kind: stringKind, s: s}
+}
+
+// Int creates an integer Value.
+func Int(i int64) Value {
+	return Value{kind: intKind, i: i}
+}
+
+// Float creates a floating point Value. NaN and infinite values are written to JSON as strings.
+func Float(f float64) Value {
+	return Value{kind: floatKind, f: f}
+}
+
+// Bool creates a boolean Value.
+func Bool(b bool) Value {
+	var i int64
+	if b {
+		i = 1
+	}
+	return Value{kind: boolKind, i: i}
+}
+
+// Duration creates a Value which is written to JSON as a number of milliseconds, like the "ms" field.
+func Duration(d time.Duration) Value {
+	return Value{kind: durationKind, i: int64(d)}
+}
+
+// Strings creates a Value which is written to JSON as an array of strings.
+func Strings(ss ...string) Value {
+	return Value{kind: stringsKind, ss: ss}
+}
+
+// Object creates a Value which is written to JSON as a nested object.
+func Object(fields ...Field) Value {
+	return Value{kind: objectKind, obj: fields}
+}
+
+// Interface returns the value as a string, int64, float64, bool, time.Duration, []string or []Field.
+func (v Value) Interface() interface{} {
+	switch v.kind {
+	case intKind:
+		return v.i
+	case floatKind:
+		return v.f
+	case boolKind:
+		return v.i == 1
+	case durationKind:
+		return time.Duration(v.i)
+	case stringsKind:
+		return v.ss
+	case objectKind:
+		return v.obj
+	}
+	return v.s
+}
+
+// String returns the value formatted as a string.
+func (v Value) String() string {
+	if v.kind == stringKind {
+		return v.s
+	}
+	if v.kind == durationKind {
+		return time.Duration(v.i).String()
+	}
+	return v.json()
+}
+
+// json returns the value encoded as JSON.
+func (v Value) json() string {
+	switch v.kind {
+	case intKind:
+		return strconv.FormatInt(v.i, 10)
+	case floatKind:
+		if math.IsNaN(v.f) || math.IsInf(v.f, 0) {
+			return `"` + strconv.FormatFloat(v.f, 'g', -1, 64) + `"`
+		}
+		return strconv.FormatFloat(v.f, 'g', -1, 64)
+	case boolKind:
+		return strconv.FormatBool(v.i == 1)
+	case durationKind:
+		return strconv.FormatInt(v.i/int64(time.Millisecond), 10)
+	case stringsKind:
+		var b strings.Builder
+		b.WriteString("[")
+		for i, s := range v.ss {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(`"` + jsonEscape(s) + `"`)
+		}
+		b.WriteString("]")
+		return b.String()
+	case objectKind:
+		var b strings.Builder
+		b.WriteString("{")
+		for i, f := range v.obj {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(`"` + jsonEscape(f.Key) + `":` + f.Value.json())
+		}
+		b.WriteString("}")
+		return b.String()
+	}
+	return `"` + jsonEscape(v.s) + `"`
+}
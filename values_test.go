@@ -0,0 +1,125 @@
+package responselogger
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValueJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    Value
+		expected string
+	}{
+		{
+			name:     "string",
+			value:    String("a \"quoted\" value"),
+			expected: `"a \"quoted\" value"`,
+		},
+		{
+			name:     "int",
+			value:    Int(-42),
+			expected: `-42`,
+		},
+		{
+			name:     "float",
+			value:    Float(0.25),
+			expected: `0.25`,
+		},
+		{
+			name:     "large float",
+			value:    Float(1e21),
+			expected: `1e+21`,
+		},
+		{
+			name:     "NaN",
+			value:    Float(math.NaN()),
+			expected: `"NaN"`,
+		},
+		{
+			name:     "infinity",
+			value:    Float(math.Inf(1)),
+			expected: `"+Inf"`,
+		},
+		{
+			name:     "true",
+			value:    Bool(true),
+			expected: `true`,
+		},
+		{
+			name:     "false",
+			value:    Bool(false),
+			expected: `false`,
+		},
+		{
+			name:     "duration",
+			value:    Duration(time.Millisecond * 1500),
+			expected: `1500`,
+		},
+		{
+			name:     "strings",
+			value:    Strings("a", "b\n"),
+			expected: `["a","b\n"]`,
+		},
+		{
+			name:     "empty strings",
+			value:    Strings(),
+			expected: `[]`,
+		},
+		{
+			name: "object",
+			value: Object(
+				Field{Key: "id", Value: Int(1)},
+				Field{Key: "nested", Value: Object(Field{Key: "flag", Value: Bool(false)})},
+			),
+			expected: `{"id":1,"nested":{"flag":false}}`,
+		},
+	}
+
+	for _, test := range tests {
+		actual := test.value.json()
+		if actual != test.expected {
+			t.Errorf("%s: expected '%v', got '%v'", test.name, test.expected, actual)
+		}
+		if !json.Valid([]byte(actual)) {
+			t.Errorf("%s: invalid JSON '%v'", test.name, actual)
+		}
+	}
+}
+
+func TestValueInterface(t *testing.T) {
+	if v := Int(3).Interface(); v != int64(3) {
+		t.Errorf("expected int64(3), got %#v", v)
+	}
+	if v := Bool(true).Interface(); v != true {
+		t.Errorf("expected true, got %#v", v)
+	}
+	if v := Duration(time.Second).Interface(); v != time.Second {
+		t.Errorf("expected 1s, got %#v", v)
+	}
+	if v := String("a").String(); v != "a" {
+		t.Errorf("expected 'a', got '%v'", v)
+	}
+}
+
+func TestJSONEntryMessageTypedFields(t *testing.T) {
+	now := func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+	e := Entry{
+		Request: httptest.NewRequest(http.MethodGet, "/", nil),
+		Status:  http.StatusOK,
+		Fields: []Field{
+			{Key: "items", Value: Int(3)},
+			{Key: "cache_hit", Value: Bool(true)},
+			{Key: "status", Value: Int(500)},
+		},
+	}
+	expected := `{"time":"2000-01-02T03:04:05Z","src":"rl","status":200,"http_2xx":1,"len":0,"ms":0,"method":"GET","path":"/","req_len":0,"req_read_ms":0,"items":3,"cache_hit":true}` + "\n"
+	actual := JSONEntryMessage(now, e, nil)
+	if expected != actual {
+		t.Errorf("expected '%v', got '%v'", expected, actual)
+	}
+}
@@ -0,0 +1,98 @@
+package responselogger
+
+import (
+	"bytes"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// maxStackDump is the maximum size of the dump of all goroutines taken to find a slow request's stack.
+const maxStackDump = 16 * 1024 * 1024
+
+// watch starts a timer which logs a "still running" entry if the request is still being handled after
+// h.WatchdogThreshold. Call the returned function when the handler returns to stop the timer.
+//
+// The handler may change the request while the timer is running, so the entry is built from a copy of the request
+// taken before the timer starts. Fields are read from the field bag, which is safe for concurrent use.
+func (h Handler) watch(r *http.Request, start time.Time, requestID string, trace TraceContext) (stop func() bool) {
+	var goroutine string
+	if h.WatchdogStack {
+		goroutine = currentGoroutineID()
+	}
+	ctx := r.Context()
+	snapshot := r.Clone(ctx)
+	remoteIP := ClientIP(r, h.ClientIPHeader, h.TrustedProxies)
+	inFlight := inFlightCount(ctx)
+	t := time.AfterFunc(h.WatchdogThreshold, func() {
+		e := Entry{
+			Request:   snapshot,
+			Duration:  time.Now().Sub(start),
+			Running:   true,
+			RequestID: requestID,
+			RemoteIP:  remoteIP,
+			InFlight:  inFlight,
+			Trace:     trace,
+			Fields:    Fields(ctx),
+		}
+		if goroutine != "" {
+			e.Stack = goroutineStack(goroutine)
+		}
+		h.log(e)
+	})
+	return t.Stop
+}
+
+// currentGoroutineID returns the ID of the calling goroutine, as shown in stack traces.
+func currentGoroutineID() string {
+	var buf [64]byte
+	s := buf[:runtime.Stack(buf[:], false)]
+	s = bytes.TrimPrefix(s, []byte("goroutine "))
+	if i := bytes.IndexByte(s, ' '); i > 0 {
+		return string(s[:i])
+	}
+	return ""
+}
+
+// goroutineStack returns the stack of the goroutine with the given ID, in the same format as a panic's stack.
+func goroutineStack(id string) []string {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxStackDump {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+	prefix := "goroutine " + id + " ["
+	for _, g := range strings.Split(string(buf), "\n\n") {
+		if strings.HasPrefix(g, prefix) {
+			return parseStack(g)
+		}
+	}
+	return nil
+}
+
+// parseStack converts a goroutine's stack trace from runtime.Stack into "function file:line" frames.
+func parseStack(s string) []string {
+	lines := strings.Split(s, "\n")
+	var stack []string
+	// Skip the "goroutine 1 [state]:" line, then read pairs of function and location lines.
+	for i := 1; i+1 < len(lines) && len(stack) < maxStackFrames; i += 2 {
+		f := lines[i]
+		if strings.HasSuffix(f, ")") {
+			// Remove the arguments.
+			if j := strings.LastIndex(f, "("); j > 0 {
+				f = f[:j]
+			}
+		}
+		loc := strings.TrimSpace(lines[i+1])
+		if j := strings.LastIndex(loc, " +0x"); j > 0 {
+			loc = loc[:j]
+		}
+		stack = append(stack, f+" "+loc)
+	}
+	return stack
+}
@@ -0,0 +1,142 @@
+package responselogger
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerWatchdog(t *testing.T) {
+	entries := make(chan Entry, 2)
+	release := make(chan struct{})
+	h := Handler{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}),
+		EntryLogger:       EntryLoggerFunc(func(e Entry) { entries <- e }),
+		RequestIDHeader:   DefaultRequestIDHeader,
+		NewRequestID:      func() string { return "abc" },
+		WatchdogThreshold: time.Millisecond * 10,
+		WatchdogStack:     true,
+	}
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+		close(done)
+	}()
+
+	running := <-entries
+	close(release)
+	<-done
+	final := <-entries
+
+	if !running.Running {
+		t.Errorf("expected the first entry to be logged while running")
+	}
+	if running.RequestID != "abc" {
+		t.Errorf("expected request ID 'abc', got '%v'", running.RequestID)
+	}
+	if running.Duration < h.WatchdogThreshold {
+		t.Errorf("expected the elapsed time to be at least %v, got %v", h.WatchdogThreshold, running.Duration)
+	}
+	if len(running.Stack) == 0 || !strings.Contains(running.Stack[0], "TestHandlerWatchdog") {
+		t.Errorf("expected the stack to start in the blocked handler, got %v", running.Stack)
+	}
+	if final.Running || final.Status != http.StatusOK {
+		t.Errorf("expected the final entry to be logged when the handler returned, got %+v", final)
+	}
+}
+
+func TestHandlerWatchdogNotTriggered(t *testing.T) {
+	var logged []Entry
+	h := Handler{
+		Next:              http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		EntryLogger:       EntryLoggerFunc(func(e Entry) { logged = append(logged, e) }),
+		WatchdogThreshold: time.Millisecond * 10,
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	time.Sleep(time.Millisecond * 20)
+
+	if len(logged) != 1 || logged[0].Running {
+		t.Errorf("expected only the final entry to be logged, got %+v", logged)
+	}
+}
+
+func TestHandlerWatchdogNotPassedToLogger(t *testing.T) {
+	var statuses []int
+	h := Handler{
+		Logger: func(r *http.Request, status int, len int64, d time.Duration) {
+			statuses = append(statuses, status)
+		},
+	}
+	r := httptest.NewRequest(http.MethodGet, "/slow", nil)
+	h.log(Entry{Request: r, Duration: time.Second * 30, Running: true})
+	h.log(Entry{Request: r, Status: http.StatusOK, Duration: time.Second * 31})
+
+	if len(statuses) != 1 || statuses[0] != http.StatusOK {
+		t.Errorf("expected only the completed request to be passed to the Logger, got %v", statuses)
+	}
+}
+
+func TestParseStack(t *testing.T) {
+	s := "goroutine 7 [chan receive]:\n" +
+		"main.handler({0x7b5e40, 0xc0000a2000}, 0xc0000b4000)\n" +
+		"\t/src/main.go:10 +0x25\n" +
+		"net/http.HandlerFunc.ServeHTTP(...)\n" +
+		"\t/go/src/net/http/server.go:2136\n" +
+		"created by net/http.(*Server).Serve in goroutine 1\n" +
+		"\t/go/src/net/http/server.go:3285 +0x4b4"
+	expected := []string{
+		"main.handler /src/main.go:10",
+		"net/http.HandlerFunc.ServeHTTP /go/src/net/http/server.go:2136",
+		"created by net/http.(*Server).Serve in goroutine 1 /go/src/net/http/server.go:3285",
+	}
+	actual := parseStack(s)
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+}
+
+func TestJSONEntryMessageRunning(t *testing.T) {
+	now := func() time.Time { return time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC) }
+	e := Entry{
+		Request:   httptest.NewRequest(http.MethodGet, "/slow", nil),
+		Duration:  time.Second * 30,
+		Running:   true,
+		RequestID: "abc",
+		Stack:     []string{"main.handler /src/main.go:10"},
+	}
+	expected := `{"time":"2000-01-02T03:04:05Z","src":"rl","status":0,"len":0,"method":"GET","path":"/slow","req_id":"abc","req_len":0,"req_read_ms":0,"running":true,"elapsed_ms":30000,"stack":["main.handler /src/main.go:10"]}` + "\n"
+	actual := JSONEntryMessage(now, e, nil)
+	if expected != actual {
+		t.Errorf("expected '%v', got '%v'", expected, actual)
+	}
+}
+
+func TestHandlerWatchdogRequestChangedByHandler(t *testing.T) {
+	entries := make(chan Entry, 2)
+	h := Handler{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for i := 0; len(entries) == 0; i++ {
+				r.Header.Set("X-Attempt", strconv.Itoa(i))
+				r.URL.Path = "/changed"
+				time.Sleep(time.Millisecond)
+			}
+		}),
+		EntryLogger: EntryLoggerFunc(func(e Entry) {
+			NewJSONEntryWriter(io.Discard, nil, "X-Attempt").LogEntry(e)
+			entries <- e
+		}),
+		WatchdogThreshold: time.Millisecond * 10,
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+
+	running := <-entries
+	if !running.Running || running.Request.URL.Path != "/slow" {
+		t.Errorf("expected the running entry to describe the request as it started, got %+v", running.Request.URL)
+	}
+}
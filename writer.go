@@ -0,0 +1,328 @@
+package responselogger
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// writerProxy records the status code and number of bytes written to an http.ResponseWriter.
+type writerProxy struct {
+	w        http.ResponseWriter
+	status   int
+	written  int64
+	hijacked bool
+	// writeErr is the first error returned when writing the response body.
+	writeErr error
+	// copyErr is the first error returned by ReadFrom, which may come from the source or the client.
+	copyErr error
+	// start is the time the request started, used to calculate ttfb.
+	start time.Time
+	// ttfb is the time taken until the header was written, or -1 if it hasn't been.
+	ttfb time.Duration
+	// onConnClose, if set, is called when a hijacked connection is closed.
+	onConnClose func(read, written int64)
+	// captureHeaders select the response headers to capture when the header is written.
+	captureHeaders []HeaderRule
+	// capturedHeader holds the captured response headers, or nil if they haven't been captured.
+	capturedHeader http.Header
+}
+
+func (wp *writerProxy) Header() http.Header {
+	return wp.w.Header()
+}
+
+// markWritten records the time to first byte when the header is first written. If final is false, the header is
+// informational (1xx) and the response headers aren't captured yet.
+func (wp *writerProxy) markWritten(final bool) {
+	if wp.ttfb == -1 {
+		wp.ttfb = time.Now().Sub(wp.start)
+	}
+	if final {
+		wp.captureHeader()
+	}
+}
+
+// captureHeader copies and masks the headers selected by captureHeaders, the first time it's called.
+func (wp *writerProxy) captureHeader() {
+	if len(wp.captureHeaders) == 0 || wp.capturedHeader != nil {
+		return
+	}
+	h := wp.w.Header()
+	wp.capturedHeader = make(http.Header, len(wp.captureHeaders))
+	for _, rule := range wp.captureHeaders {
+		values := h.Values(rule.Name)
+		if len(values) == 0 {
+			continue
+		}
+		captured := make([]string, len(values))
+		for i, v := range values {
+			if rule.Mask != nil {
+				v = rule.Mask(v)
+			}
+			captured[i] = v
+		}
+		wp.capturedHeader[http.CanonicalHeaderKey(rule.Name)] = captured
+	}
+}
+
+// informational returns true for 1xx status codes which are followed by the final response, i.e. not 101.
+func informational(status int) bool {
+	return status >= 100 && status <= 199 && status != http.StatusSwitchingProtocols
+}
+
+func (wp *writerProxy) Write(bytes []byte) (int, error) {
+	wp.markWritten(true)
+	bw, err := wp.w.Write(bytes)
+	wp.written += int64(bw)
+	if err != nil && wp.writeErr == nil {
+		wp.writeErr = err
+	}
+	return bw, err
+}
+
+func (wp *writerProxy) WriteHeader(status int) {
+	final := !informational(status)
+	if wp.status == -1 && final {
+		wp.status = status
+	}
+	wp.markWritten(final)
+	wp.w.WriteHeader(status)
+}
+
+// Unwrap returns the underlying http.ResponseWriter, for use by http.ResponseController.
+func (wp *writerProxy) Unwrap() http.ResponseWriter {
+	return wp.w
+}
+
+// The optional interfaces are implemented by separate types that share the writerProxy's fields, so that
+// wrap can combine exactly the set implemented by the underlying http.ResponseWriter.
+type (
+	flusherProxy    writerProxy
+	hijackerProxy   writerProxy
+	pusherProxy     writerProxy
+	readerFromProxy writerProxy
+)
+
+func (p *flusherProxy) Flush() {
+	(*writerProxy)(p).markWritten(true)
+	p.w.(http.Flusher).Flush()
+}
+
+func (p *hijackerProxy) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := p.w.(http.Hijacker).Hijack()
+	if err != nil {
+		return conn, brw, err
+	}
+	p.hijacked = true
+	if p.onConnClose != nil {
+		hc := &hijackedConn{Conn: conn, onClose: p.onConnClose}
+		conn, brw = hc, hc.readWriter(brw)
+	}
+	return conn, brw, err
+}
+
+func (p *pusherProxy) Push(target string, opts *http.PushOptions) error {
+	return p.w.(http.Pusher).Push(target, opts)
+}
+
+func (p *readerFromProxy) ReadFrom(src io.Reader) (int64, error) {
+	(*writerProxy)(p).markWritten(true)
+	n, err := p.w.(io.ReaderFrom).ReadFrom(src)
+	p.written += n
+	if err != nil && p.copyErr == nil {
+		// ReadFrom errors may come from the source rather than the client, but the net/http implementation
+		// doesn't distinguish between them, so they're kept apart from write errors.
+		p.copyErr = err
+	}
+	return n, err
+}
+
+// bodyReader counts the bytes read from a request body and the time spent reading them.
+type bodyReader struct {
+	io.ReadCloser
+	read     int64
+	duration time.Duration
+}
+
+func (br *bodyReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := br.ReadCloser.Read(p)
+	br.duration += time.Now().Sub(start)
+	br.read += int64(n)
+	return n, err
+}
+
+// hijackedConn counts the bytes read from and written to a hijacked connection.
+type hijackedConn struct {
+	net.Conn
+	read    int64
+	written int64
+	once    sync.Once
+	onClose func(read, written int64)
+}
+
+// readWriter replaces brw, which reads from and writes to the underlying connection, with one which uses c so that
+// the bytes are counted. Bytes already buffered by brw are carried over, and counted as read or written.
+func (c *hijackedConn) readWriter(brw *bufio.ReadWriter) *bufio.ReadWriter {
+	if brw == nil {
+		return nil
+	}
+	buffered, _ := brw.Reader.Peek(brw.Reader.Buffered())
+	c.read += int64(len(buffered))
+	c.written += int64(brw.Writer.Buffered())
+	brw.Writer.Flush()
+	r := io.MultiReader(bytes.NewReader(append([]byte(nil), buffered...)), c)
+	return bufio.NewReadWriter(bufio.NewReaderSize(r, brw.Reader.Size()), bufio.NewWriterSize(c, brw.Writer.Size()))
+}
+
+func (c *hijackedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.read, int64(n))
+	return n, err
+}
+
+func (c *hijackedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.written, int64(n))
+	return n, err
+}
+
+func (c *hijackedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		c.onClose(atomic.LoadInt64(&c.read), atomic.LoadInt64(&c.written))
+	})
+	return err
+}
+
+const (
+	implementsFlusher = 1 << iota
+	implementsHijacker
+	implementsPusher
+	implementsReaderFrom
+)
+
+// wrap returns an http.ResponseWriter which implements the same optional interfaces
+// (http.Flusher, http.Hijacker, http.Pusher and io.ReaderFrom) as the underlying writer.
+func (wp *writerProxy) wrap() http.ResponseWriter {
+	var i int
+	if _, ok := wp.w.(http.Flusher); ok {
+		i |= implementsFlusher
+	}
+	if _, ok := wp.w.(http.Hijacker); ok {
+		i |= implementsHijacker
+	}
+	if _, ok := wp.w.(http.Pusher); ok {
+		i |= implementsPusher
+	}
+	if _, ok := wp.w.(io.ReaderFrom); ok {
+		i |= implementsReaderFrom
+	}
+
+	f := (*flusherProxy)(wp)
+	h := (*hijackerProxy)(wp)
+	p := (*pusherProxy)(wp)
+	rf := (*readerFromProxy)(wp)
+
+	switch i {
+	case implementsFlusher:
+		return struct {
+			*writerProxy
+			http.Flusher
+		}{wp, f}
+	case implementsHijacker:
+		return struct {
+			*writerProxy
+			http.Hijacker
+		}{wp, h}
+	case implementsFlusher | implementsHijacker:
+		return struct {
+			*writerProxy
+			http.Flusher
+			http.Hijacker
+		}{wp, f, h}
+	case implementsPusher:
+		return struct {
+			*writerProxy
+			http.Pusher
+		}{wp, p}
+	case implementsFlusher | implementsPusher:
+		return struct {
+			*writerProxy
+			http.Flusher
+			http.Pusher
+		}{wp, f, p}
+	case implementsHijacker | implementsPusher:
+		return struct {
+			*writerProxy
+			http.Hijacker
+			http.Pusher
+		}{wp, h, p}
+	case implementsFlusher | implementsHijacker | implementsPusher:
+		return struct {
+			*writerProxy
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{wp, f, h, p}
+	case implementsReaderFrom:
+		return struct {
+			*writerProxy
+			io.ReaderFrom
+		}{wp, rf}
+	case implementsFlusher | implementsReaderFrom:
+		return struct {
+			*writerProxy
+			http.Flusher
+			io.ReaderFrom
+		}{wp, f, rf}
+	case implementsHijacker | implementsReaderFrom:
+		return struct {
+			*writerProxy
+			http.Hijacker
+			io.ReaderFrom
+		}{wp, h, rf}
+	case implementsFlusher | implementsHijacker | implementsReaderFrom:
+		return struct {
+			*writerProxy
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{wp, f, h, rf}
+	case implementsPusher | implementsReaderFrom:
+		return struct {
+			*writerProxy
+			http.Pusher
+			io.ReaderFrom
+		}{wp, p, rf}
+	case implementsFlusher | implementsPusher | implementsReaderFrom:
+		return struct {
+			*writerProxy
+			http.Flusher
+			http.Pusher
+			io.ReaderFrom
+		}{wp, f, p, rf}
+	case implementsHijacker | implementsPusher | implementsReaderFrom:
+		return struct {
+			*writerProxy
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{wp, h, p, rf}
+	case implementsFlusher | implementsHijacker | implementsPusher | implementsReaderFrom:
+		return struct {
+			*writerProxy
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{wp, f, h, p, rf}
+	}
+	return wp
+}
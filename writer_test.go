@@ -0,0 +1,305 @@
+package responselogger
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testFlusher struct{ flushed bool }
+
+func (f *testFlusher) Flush() { f.flushed = true }
+
+type testHijacker struct{ hijacked bool }
+
+func (h *testHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return nil, nil, nil
+}
+
+type testPusher struct{ target string }
+
+func (p *testPusher) Push(target string, opts *http.PushOptions) error {
+	p.target = target
+	return nil
+}
+
+type testReaderFrom struct{ w io.Writer }
+
+func (rf testReaderFrom) ReadFrom(src io.Reader) (int64, error) {
+	return io.Copy(rf.w, src)
+}
+
+// newTestResponseWriter creates an http.ResponseWriter implementing the optional interfaces selected by i.
+func newTestResponseWriter(i int) (http.ResponseWriter, *httptest.ResponseRecorder, *testFlusher, *testHijacker, *testPusher) {
+	rr := httptest.NewRecorder()
+	f, h, p := &testFlusher{}, &testHijacker{}, &testPusher{}
+	rf := testReaderFrom{w: rr.Body}
+	w := struct{ http.ResponseWriter }{rr}
+	switch i {
+	case 0:
+		return w, rr, f, h, p
+	case implementsFlusher:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+		}{rr, f}, rr, f, h, p
+	case implementsHijacker:
+		return struct {
+			http.ResponseWriter
+			http.Hijacker
+		}{rr, h}, rr, f, h, p
+	case implementsFlusher | implementsHijacker:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Hijacker
+		}{rr, f, h}, rr, f, h, p
+	case implementsPusher:
+		return struct {
+			http.ResponseWriter
+			http.Pusher
+		}{rr, p}, rr, f, h, p
+	case implementsFlusher | implementsPusher:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Pusher
+		}{rr, f, p}, rr, f, h, p
+	case implementsHijacker | implementsPusher:
+		return struct {
+			http.ResponseWriter
+			http.Hijacker
+			http.Pusher
+		}{rr, h, p}, rr, f, h, p
+	case implementsFlusher | implementsHijacker | implementsPusher:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{rr, f, h, p}, rr, f, h, p
+	case implementsReaderFrom:
+		return struct {
+			http.ResponseWriter
+			io.ReaderFrom
+		}{rr, rf}, rr, f, h, p
+	case implementsFlusher | implementsReaderFrom:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			io.ReaderFrom
+		}{rr, f, rf}, rr, f, h, p
+	case implementsHijacker | implementsReaderFrom:
+		return struct {
+			http.ResponseWriter
+			http.Hijacker
+			io.ReaderFrom
+		}{rr, h, rf}, rr, f, h, p
+	case implementsFlusher | implementsHijacker | implementsReaderFrom:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{rr, f, h, rf}, rr, f, h, p
+	case implementsPusher | implementsReaderFrom:
+		return struct {
+			http.ResponseWriter
+			http.Pusher
+			io.ReaderFrom
+		}{rr, p, rf}, rr, f, h, p
+	case implementsFlusher | implementsPusher | implementsReaderFrom:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Pusher
+			io.ReaderFrom
+		}{rr, f, p, rf}, rr, f, h, p
+	case implementsHijacker | implementsPusher | implementsReaderFrom:
+		return struct {
+			http.ResponseWriter
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{rr, h, p, rf}, rr, f, h, p
+	default:
+		return struct {
+			http.ResponseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{rr, f, h, p, rf}, rr, f, h, p
+	}
+}
+
+func TestWriterProxyOptionalInterfaces(t *testing.T) {
+	all := implementsFlusher | implementsHijacker | implementsPusher | implementsReaderFrom
+	for i := 0; i <= all; i++ {
+		w, rr, f, h, p := newTestResponseWriter(i)
+
+		var entry Entry
+		handler := Handler{
+			Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, ok := w.(http.Flusher); ok != (i&implementsFlusher != 0) {
+					t.Errorf("%04b: expected http.Flusher to be implemented: %v, got %v", i, !ok, ok)
+				}
+				if _, ok := w.(http.Hijacker); ok != (i&implementsHijacker != 0) {
+					t.Errorf("%04b: expected http.Hijacker to be implemented: %v, got %v", i, !ok, ok)
+				}
+				if _, ok := w.(http.Pusher); ok != (i&implementsPusher != 0) {
+					t.Errorf("%04b: expected http.Pusher to be implemented: %v, got %v", i, !ok, ok)
+				}
+				if _, ok := w.(io.ReaderFrom); ok != (i&implementsReaderFrom != 0) {
+					t.Errorf("%04b: expected io.ReaderFrom to be implemented: %v, got %v", i, !ok, ok)
+				}
+				if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); !ok || u.Unwrap() == nil {
+					t.Errorf("%04b: expected Unwrap to return the underlying writer", i)
+				}
+
+				if fl, ok := w.(http.Flusher); ok {
+					fl.Flush()
+				}
+				if hj, ok := w.(http.Hijacker); ok {
+					hj.Hijack()
+				}
+				if pu, ok := w.(http.Pusher); ok {
+					pu.Push("/style.css", nil)
+				}
+				if rf, ok := w.(io.ReaderFrom); ok {
+					rf.ReadFrom(strings.NewReader("read from"))
+					return
+				}
+				w.Write([]byte("read from"))
+			}),
+			EntryLogger: EntryLoggerFunc(func(e Entry) { entry = e }),
+			Skip:        SkipHealthEndpoint,
+		}
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if f.flushed != (i&implementsFlusher != 0) {
+			t.Errorf("%04b: expected flushed to be %v", i, !f.flushed)
+		}
+		if h.hijacked != (i&implementsHijacker != 0) {
+			t.Errorf("%04b: expected hijacked to be %v", i, !h.hijacked)
+		}
+		if (p.target == "/style.css") != (i&implementsPusher != 0) {
+			t.Errorf("%04b: unexpected push target '%v'", i, p.target)
+		}
+		if rr.Body.String() != "read from" {
+			t.Errorf("%04b: expected body 'read from', got '%v'", i, rr.Body.String())
+		}
+		if entry.Length != int64(len("read from")) {
+			t.Errorf("%04b: expected length %d to be logged, got %d", i, len("read from"), entry.Length)
+		}
+	}
+}
+
+type testDeadliner struct{ deadline time.Time }
+
+func (d *testDeadliner) SetWriteDeadline(deadline time.Time) error {
+	d.deadline = deadline
+	return nil
+}
+
+func TestWriterProxyResponseController(t *testing.T) {
+	d := &testDeadliner{}
+	w := struct {
+		http.ResponseWriter
+		*testDeadliner
+	}{httptest.NewRecorder(), d}
+	deadline := time.Date(2000, time.January, 2, 3, 4, 5, 6, time.UTC)
+
+	handler := Handler{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := http.NewResponseController(w).SetWriteDeadline(deadline); err != nil {
+				t.Errorf("unexpected error setting write deadline: %v", err)
+			}
+		}),
+		EntryLogger: EntryLoggerFunc(func(e Entry) {}),
+		Skip:        SkipHealthEndpoint,
+	}
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !d.deadline.Equal(deadline) {
+		t.Errorf("expected the deadline to be set on the underlying writer, got %v", d.deadline)
+	}
+}
+
+func TestHijackedConnectionLogging(t *testing.T) {
+	entries := make(chan Entry, 2)
+	h := Handler{
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, brw, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				t.Errorf("unexpected error hijacking connection: %v", err)
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n"))
+				line, _ := brw.ReadString('\n')
+				conn.Write([]byte("echo: " + line))
+			}()
+		}),
+		EntryLogger:          EntryLoggerFunc(func(e Entry) { entries <- e }),
+		Skip:                 SkipHealthEndpoint,
+		LogHijackedConnClose: true,
+	}
+	s := httptest.NewServer(h)
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial test server: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: example.com\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n"))
+	conn.Write([]byte("hello\n"))
+	io.ReadAll(conn)
+
+	upgrade := <-entries
+	if !upgrade.Hijacked || upgrade.ConnClosed {
+		t.Errorf("expected first entry to be hijacked and not closed, got %+v", upgrade)
+	}
+	if upgrade.Status != http.StatusSwitchingProtocols {
+		t.Errorf("expected status %d, got %d", http.StatusSwitchingProtocols, upgrade.Status)
+	}
+
+	closed := <-entries
+	if !closed.Hijacked || !closed.ConnClosed {
+		t.Errorf("expected second entry to be hijacked and closed, got %+v", closed)
+	}
+	expectedWritten := int64(len("HTTP/1.1 101 Switching Protocols\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n") + len("echo: hello\n"))
+	if closed.ConnWritten != expectedWritten {
+		t.Errorf("expected %d bytes written, got %d", expectedWritten, closed.ConnWritten)
+	}
+	if closed.ConnRead != int64(len("hello\n")) {
+		t.Errorf("expected %d bytes read, got %d", len("hello\n"), closed.ConnRead)
+	}
+	if closed.Duration < upgrade.Duration {
+		t.Errorf("expected connection duration %v to be at least the handler duration %v", closed.Duration, upgrade.Duration)
+	}
+}
+
+func TestHijackedConnectionCloseNotPassedToLogger(t *testing.T) {
+	var statuses []int
+	h := Handler{
+		Logger: func(r *http.Request, status int, len int64, d time.Duration) {
+			statuses = append(statuses, status)
+		},
+	}
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	h.log(Entry{Request: r, Status: http.StatusSwitchingProtocols, Hijacked: true})
+	h.log(Entry{Request: r, Status: http.StatusSwitchingProtocols, Hijacked: true, ConnClosed: true})
+
+	if len(statuses) != 1 {
+		t.Errorf("expected only the upgrade to be passed to the Logger, got %v", statuses)
+	}
+}